@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 
 	"github.com/dustin/go-humanize"
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 )
 
@@ -39,7 +40,7 @@ func executeDu(args []string) {
 		root = args[0]
 	}
 
-	total, ok := diskUsageWalkDir(root)
+	total, ok := diskUsageWalkDir(afero.NewOsFs(), root)
 	if ok {
 		if humanReadable {
 			fmt.Printf("%s %s\n", humanize.Bytes(uint64(total)), root)
@@ -152,24 +153,20 @@ func diskUsagePipelined(folder string) (int64, error) {
 	return total, nil
 }
 
-// Calculate disk usage using WalkDir
-func diskUsageWalkDir(folder string) (int64, bool) {
+// Calculate disk usage by walking the given filesystem
+func diskUsageWalkDir(fsys afero.Fs, folder string) (int64, bool) {
 	var total int64
-	filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+	afero.Walk(fsys, folder, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Cannot read '%s': %s\n", path, err)
 			return nil
 		}
 
-		if (d.Type().Type() & os.ModeSymlink) != 0 {
+		// walk uses lstat when the filesystem supports it, so symlinks are not followed
+		if (info.Mode().Type() & os.ModeSymlink) != 0 {
 			return nil
 		}
 
-		info, err := os.Stat(path)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Cannot stat file '%s': %s\n", path, err)
-			return nil
-		}
 		total += info.Size()
 
 		return nil
@@ -3,8 +3,36 @@ package cmd
 import (
 	"os"
 	"testing"
+
+	"github.com/spf13/afero"
 )
 
+func TestDiskUsageWalkDir(t *testing.T) {
+	appFs := afero.NewMemMapFs()
+	appFs.MkdirAll("/data/sub", 0755)
+	afero.WriteFile(appFs, "/data/a.txt", make([]byte, 100), 0644)
+	afero.WriteFile(appFs, "/data/sub/b.txt", make([]byte, 20), 0644)
+
+	dirInfo, err := appFs.Stat("/data")
+	if err != nil {
+		t.Fatalf("Error not expected %s", err)
+	}
+	subInfo, err := appFs.Stat("/data/sub")
+	if err != nil {
+		t.Fatalf("Error not expected %s", err)
+	}
+
+	got, ok := diskUsageWalkDir(appFs, "/data")
+	if !ok {
+		t.Errorf("got %v want %v", ok, true)
+	}
+
+	want := 120 + dirInfo.Size() + subInfo.Size()
+	if got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
 func BenchmarkDiskusage(b *testing.B) {
 	os.Stderr, _ = os.Open(os.DevNull)
 	for i := 0; i < b.N; i++ {
@@ -22,6 +50,6 @@ func BenchmarkDiskusagePipelined(b *testing.B) {
 func BenchmarkDiskusageWalkDir(b *testing.B) {
 	os.Stderr, _ = os.Open(os.DevNull)
 	for i := 0; i < b.N; i++ {
-		diskUsageWalkDir(".")
+		diskUsageWalkDir(afero.NewOsFs(), ".")
 	}
 }
@@ -4,28 +4,37 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 )
 
 var name string
 var mmin string
+var changedWithin string
+var changedBefore string
 var printLs bool
 var printZero bool
+var quietErrors bool
 
 // findCmd represents the find command
 var findCmd = &cobra.Command{
-	Use:   "find [path]",
-	Short: "Unix find command",
-	Run: func(cmd *cobra.Command, args []string) {
-		executeFind(args)
+	Use:          "find [path]",
+	Short:        "Unix find command",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return executeFind(args)
 	},
 }
 
@@ -33,8 +42,11 @@ func init() {
 	rootCmd.AddCommand(findCmd)
 	findCmd.Flags().StringVar(&name, "name", "", "name pattern")
 	findCmd.Flags().StringVar(&mmin, "mmin", "", "file modification diff minutes")
+	findCmd.Flags().StringVar(&changedWithin, "changed-within", "", "file modified within duration (e.g. 2h30m, 3d) or since date (e.g. 2024-01-01)")
+	findCmd.Flags().StringVar(&changedBefore, "changed-before", "", "file modified before duration ago (e.g. 2h30m, 3d) or before date (e.g. 2024-01-01)")
 	findCmd.Flags().BoolVar(&printLs, "ls", false, "list file details")
 	findCmd.Flags().BoolVarP(&printZero, "print0", "0", false, "print file names null delimited")
+	findCmd.Flags().BoolVar(&quietErrors, "quiet-errors", false, "do not print traversal errors as they occur, only the final summary")
 }
 
 type fileFilter interface {
@@ -45,6 +57,15 @@ type nameFilter struct {
 	name string
 }
 
+// newNameFilter validates the pattern once, so that a malformed pattern
+// is reported upfront instead of for every file visited
+func newNameFilter(name string) (*nameFilter, error) {
+	if err := validatePattern(name); err != nil {
+		return nil, err
+	}
+	return &nameFilter{name: name}, nil
+}
+
 func (n *nameFilter) Accept(path string) bool {
 	fileName := filepath.Base(path)
 	matched, err := filepath.Match(n.name, fileName)
@@ -55,6 +76,56 @@ func (n *nameFilter) Accept(path string) bool {
 	return matched
 }
 
+// validatePattern checks the syntax of the whole pattern as filepath.Match does.
+// filepath.Match itself only reports errors in the part of the pattern it reaches
+// while matching a name, e.g. "x*[]" is accepted when matched against "".
+func validatePattern(pattern string) error {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+			if i == len(pattern) {
+				return filepath.ErrBadPattern
+			}
+		case '[':
+			i++
+			if i < len(pattern) && pattern[i] == '^' {
+				i++
+			}
+			for ranges := 0; i == len(pattern) || pattern[i] != ']' || ranges == 0; ranges++ {
+				var err error
+				if i, err = patternClassChar(pattern, i); err != nil {
+					return err
+				}
+				if i < len(pattern) && pattern[i] == '-' {
+					if i, err = patternClassChar(pattern, i+1); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// patternClassChar checks the possibly escaped character at i in a character class and returns the index after it
+func patternClassChar(pattern string, i int) (int, error) {
+	if i == len(pattern) || pattern[i] == '-' || pattern[i] == ']' {
+		return i, filepath.ErrBadPattern
+	}
+	if pattern[i] == '\\' {
+		i++
+		if i == len(pattern) {
+			return i, filepath.ErrBadPattern
+		}
+	}
+	r, size := utf8.DecodeRuneInString(pattern[i:])
+	if r == utf8.RuneError && size == 1 {
+		return i, filepath.ErrBadPattern
+	}
+	return i + size, nil
+}
+
 type timeFilterType int
 
 const (
@@ -115,7 +186,115 @@ func parseMmin(mmin string, now time.Time) (*timeFilter, error) {
 
 }
 
-func executeFind(args []string) {
+var errInvalidTimeSpec = errors.New("expected a duration (e.g. 90m, 2h30m, 3d, 1w) or a date (e.g. 2024-01-01, 2024-01-01 15:04)")
+
+var errDurationTooLarge = errors.New("duration is too large")
+
+// layouts accepted for calendar expressions, tried in order
+var timeSpecLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+}
+
+// day and week units are not supported by time.ParseDuration, so they are handled separately
+// and the remaining part (if any) is parsed as a regular Go duration e.g. 1d12h
+var calendarDurationRegexp = regexp.MustCompile(`^(\d+)([dw])(.*)$`)
+
+// changedFilter accepts files modified after (within) or before the threshold.
+// Unlike timeFilter, modification times are compared with full precision.
+type changedFilter struct {
+	threshold time.Time
+	before    bool
+	statFunc  fsStatFunc
+}
+
+func newChangedFilter(threshold time.Time, before bool) *changedFilter {
+	return &changedFilter{threshold: threshold, before: before, statFunc: os.Stat}
+}
+
+func (c *changedFilter) Accept(path string) bool {
+	info, err := c.statFunc(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot stat file", err)
+		return false
+	}
+	if c.before {
+		return info.ModTime().Before(c.threshold)
+	}
+	return !info.ModTime().Before(c.threshold)
+}
+
+// parseTimeSpec converts a duration relative to now (2h30m, 3d, 1w2d) or a date (2024-01-01) to a point in time
+func parseTimeSpec(spec string, now time.Time) (time.Time, error) {
+	for _, layout := range timeSpecLayouts {
+		t, err := time.ParseInLocation(layout, spec, now.Location())
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	d, err := parseCalendarDuration(spec)
+	if errors.Is(err, errDurationTooLarge) {
+		return time.Time{}, fmt.Errorf("%q: %w", spec, err)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q: %w", spec, errInvalidTimeSpec)
+	}
+
+	if d < 0 {
+		return time.Time{}, fmt.Errorf("%q: duration must not be negative", spec)
+	}
+
+	return now.Add(-d), nil
+}
+
+func parseCalendarDuration(spec string) (time.Duration, error) {
+	m := calendarDurationRegexp.FindStringSubmatch(spec)
+	if m == nil {
+		return time.ParseDuration(spec)
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, err
+	}
+
+	unit := 24 * time.Hour
+	if m[2] == "w" {
+		unit *= 7
+	}
+	if int64(n) > math.MaxInt64/int64(unit) {
+		return 0, errDurationTooLarge
+	}
+	d := time.Duration(n) * unit
+
+	rest := m[3]
+	if len(rest) == 0 {
+		return d, nil
+	}
+
+	if rest[0] >= '0' && rest[0] <= '9' {
+		// allow combinations like 1w2d
+		restDuration, err := parseCalendarDuration(rest)
+		if err != nil {
+			return 0, err
+		}
+		if restDuration > math.MaxInt64-d {
+			return 0, errDurationTooLarge
+		}
+		return d + restDuration, nil
+	}
+
+	return 0, errInvalidTimeSpec
+}
+
+func executeFind(args []string) error {
+	return executeFindWithFs(args, afero.NewOsFs())
+}
+
+func executeFindWithFs(args []string, fsys afero.Fs) error {
 	path := "."
 	if len(args) != 0 {
 		path = args[0]
@@ -124,26 +303,63 @@ func executeFind(args []string) {
 	filters := make([]fileFilter, 0)
 
 	if len(name) != 0 {
-		filters = append(filters, &nameFilter{name: name})
+		nf, err := newNameFilter(name)
+		if err != nil {
+			return fmt.Errorf("invalid value for --name: %q %w", name, err)
+		}
+		filters = append(filters, nf)
 	}
 
 	if len(mmin) != 0 {
 		mminFilter, err := parseMmin(mmin, time.Now())
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Cannot parse parameter mmin: %s %s\n", mmin, err)
-			return
+			return fmt.Errorf("invalid value for --mmin: %q %w", mmin, err)
 		}
+		mminFilter.statFunc = fsys.Stat
 		filters = append(filters, mminFilter)
 	}
 
+	if len(changedWithin) != 0 {
+		threshold, err := parseTimeSpec(changedWithin, time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid value for --changed-within: %w", err)
+		}
+		changedWithinFilter := newChangedFilter(threshold, false)
+		changedWithinFilter.statFunc = fsys.Stat
+		filters = append(filters, changedWithinFilter)
+	}
+
+	if len(changedBefore) != 0 {
+		threshold, err := parseTimeSpec(changedBefore, time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid value for --changed-before: %w", err)
+		}
+		changedBeforeFilter := newChangedFilter(threshold, true)
+		changedBeforeFilter.statFunc = fsys.Stat
+		filters = append(filters, changedBeforeFilter)
+	}
+
 	onfind := printLn
 	if printZero {
 		onfind = print0
 	} else if printLs {
-		onfind = printFileDetails
+		onfind = func(file string) {
+			printFileDetails(fsys, file)
+		}
+	}
+
+	result := findAll(fsys, path, filters, onfind, quietErrors)
+	if len(result.permissionDenied) != 0 {
+		fmt.Fprintf(os.Stderr, "Permission denied for %d path(s):\n", len(result.permissionDenied))
+		for _, p := range result.permissionDenied {
+			fmt.Fprintf(os.Stderr, "  %s\n", p)
+		}
 	}
 
-	findAll(path, filters, onfind)
+	if result.errorCount != 0 {
+		return fmt.Errorf("%d error(s) occurred while traversing %s", result.errorCount, path)
+	}
+	return nil
 }
 
 func printLn(file string) {
@@ -154,8 +370,8 @@ func print0(file string) {
 	fmt.Printf("%s\u0000", file)
 }
 
-func printFileDetails(file string) {
-	info, err := os.Stat(file)
+func printFileDetails(fsys afero.Fs, file string) {
+	info, err := fsys.Stat(file)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "file stat error %s %s", file, err)
 		return
@@ -169,10 +385,22 @@ func printFileDetails(file string) {
 	fmt.Printf("%s\t%d\t%s\t%s\n", info.Mode().Perm(), info.Size(), info.ModTime().Format("Jan 02 2006 15:04:05"), file)
 }
 
-func findAll(path string, filters []fileFilter, onfind func(string)) {
-	filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+type findResult struct {
+	errorCount       int
+	permissionDenied []string
+}
+
+func findAll(fsys afero.Fs, path string, filters []fileFilter, onfind func(string), quiet bool) *findResult {
+	result := &findResult{}
+	afero.Walk(fsys, path, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error while traversing %s %s\n", path, err)
+			result.errorCount++
+			if errors.Is(err, fs.ErrPermission) {
+				result.permissionDenied = append(result.permissionDenied, path)
+			}
+			if !quiet {
+				fmt.Fprintf(os.Stderr, "Error while traversing %s %s\n", path, err)
+			}
 			return nil
 		}
 
@@ -187,4 +415,6 @@ func findAll(path string, filters []fileFilter, onfind func(string)) {
 
 		return nil
 	})
+
+	return result
 }
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"io/fs"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/spf13/afero"
 )
 
 func TestParseMmin(t *testing.T) {
@@ -85,6 +90,169 @@ func TestTimeFilterAccept(t *testing.T) {
 	}
 }
 
+func TestParseTimeSpec(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  time.Time
+	}{
+		{"minutes", "90m", parseTime(t, "2023.12.28 07:30")},
+		{"hours and minutes", "2h30m", parseTime(t, "2023.12.28 06:30")},
+		{"days", "3d", parseTime(t, "2023.12.25 09:00")},
+		{"weeks and days", "1w2d", parseTime(t, "2023.12.19 09:00")},
+		{"days and hours", "1d12h", parseTime(t, "2023.12.26 21:00")},
+		{"date", "2023-12-01", parseTime(t, "2023.12.01 00:00")},
+		{"date and time", "2023-12-01 15:04", parseTime(t, "2023.12.01 15:04")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			now := parseTime(t, "2023.12.28 09:00")
+			got, err := parseTimeSpec(c.input, now)
+			if err != nil {
+				t.Errorf("Error not expected %s", err)
+			}
+
+			if !got.Equal(c.want) {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeSpecInvalid(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{"plain number", "5"},
+		{"unknown unit", "5y"},
+		{"garbage after days", "3dx"},
+		{"invalid date", "2023-13-45"},
+		{"negative duration", "-2h"},
+		{"too many weeks", "100000000000w"},
+		{"too many days", "200000d"},
+		{"weeks and hours too large", "15000w2562047h"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			now := parseTime(t, "2023.12.28 09:00")
+			_, err := parseTimeSpec(c.input, now)
+			if err == nil {
+				t.Errorf("Error expected here")
+			}
+		})
+	}
+
+	_, err := parseTimeSpec("5y", parseTime(t, "2023.12.28 09:00"))
+	if !errors.Is(err, errInvalidTimeSpec) {
+		t.Errorf("got %v want %v", err, errInvalidTimeSpec)
+	}
+
+	_, err = parseTimeSpec("100000000000w", parseTime(t, "2023.12.28 09:00"))
+	if !errors.Is(err, errDurationTooLarge) {
+		t.Errorf("got %v want %v", err, errDurationTooLarge)
+	}
+}
+
+func TestChangedFilterAccept(t *testing.T) {
+	files := map[string]fileStat{
+		"30_seconds_ago.txt": {"30_seconds_ago.txt", parseTime(t, "2023.12.28 09:00").Add(-30 * time.Second)},
+		"2_days_ago.txt":     {"2_days_ago.txt", parseTime(t, "2023.12.26 09:00")},
+	}
+
+	statFunc := func(name string) (fs.FileInfo, error) {
+		return files[name], nil
+	}
+
+	threshold := parseTime(t, "2023.12.28 08:59")
+	cases := []struct {
+		name        string
+		inputFile   fileStat
+		inputFilter changedFilter
+		want        bool
+	}{
+		{"within match", files["30_seconds_ago.txt"], changedFilter{threshold, false, statFunc}, true},
+		{"within no match", files["2_days_ago.txt"], changedFilter{threshold, false, statFunc}, false},
+		{"before match", files["2_days_ago.txt"], changedFilter{threshold, true, statFunc}, true},
+		{"before no match", files["30_seconds_ago.txt"], changedFilter{threshold, true, statFunc}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.inputFilter.Accept(c.inputFile.name)
+			if got != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNewNameFilterInvalidPattern(t *testing.T) {
+	cases := []string{"[a-", "x*[]", "*.txt[", `a\`, "[]a]", "[a-]", "*[^]"}
+
+	for _, pattern := range cases {
+		t.Run(pattern, func(t *testing.T) {
+			_, err := newNameFilter(pattern)
+			if !errors.Is(err, filepath.ErrBadPattern) {
+				t.Errorf("got %v want %v", err, filepath.ErrBadPattern)
+			}
+		})
+	}
+}
+
+func TestNewNameFilterValidPattern(t *testing.T) {
+	cases := []string{"*.txt", "[a-z]?.log", "[^0-9]*", `\[x\]`, "a]b", `[\]\-]`, "[ä-ö]*"}
+
+	for _, pattern := range cases {
+		t.Run(pattern, func(t *testing.T) {
+			_, err := newNameFilter(pattern)
+			if err != nil {
+				t.Errorf("Error not expected %s", err)
+			}
+		})
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	appFs := afero.NewMemMapFs()
+	appFs.MkdirAll("/data/sub", 0755)
+	afero.WriteFile(appFs, "/data/a.txt", []byte(""), 0644)
+	afero.WriteFile(appFs, "/data/b.log", []byte(""), 0644)
+	afero.WriteFile(appFs, "/data/sub/c.txt", []byte(""), 0644)
+
+	nf, err := newNameFilter("*.txt")
+	if err != nil {
+		t.Fatalf("Error not expected %s", err)
+	}
+
+	found := make([]string, 0)
+	result := findAll(appFs, "/data", []fileFilter{nf}, func(s string) { found = append(found, s) }, true)
+
+	want := []string{"/data/a.txt", "/data/sub/c.txt"}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("got %v want %v", found, want)
+	}
+
+	if result.errorCount != 0 {
+		t.Errorf("got %v want %v", result.errorCount, 0)
+	}
+}
+
+func TestFindAllCountsErrors(t *testing.T) {
+	found := make([]string, 0)
+	result := findAll(afero.NewMemMapFs(), "/does_not_exist", nil, func(s string) { found = append(found, s) }, true)
+
+	if result.errorCount != 1 {
+		t.Errorf("got %v want %v", result.errorCount, 1)
+	}
+
+	if len(found) != 0 {
+		t.Errorf("got %v want none", found)
+	}
+}
+
 type fileStat struct {
 	name    string
 	modTime time.Time
@@ -259,6 +259,67 @@ func parseBootTime(r io.Reader, now time.Time) (time.Time, error) {
 	return now.Add(diff), nil
 }
 
+func readLoadAverage() (float64, error) {
+	f, err := os.Open(filepath.Join(procfsRoot, "loadavg"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseLoadAverage(f)
+}
+
+func parseLoadAverage(r io.Reader) (float64, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	// /proc/loadavg
+	//          The first three fields in this file are load average
+	//          figures giving the number of jobs in the run queue (state
+	//          R) or waiting for disk I/O (state D) averaged over 1, 5,
+	//          and 15 minutes.
+	cols := strings.Fields(string(b))
+	if len(cols) == 0 {
+		return 0, errors.New("invalid loadavg file, it is empty")
+	}
+
+	return strconv.ParseFloat(cols[0], 64)
+}
+
+func readMemAvailable() (uint64, error) {
+	f, err := os.Open(filepath.Join(procfsRoot, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseMemAvailable(f)
+}
+
+// parseMemAvailable returns MemAvailable in /proc/meminfo in bytes, which is an estimate of
+// how much memory is available for starting new applications, without swapping
+func parseMemAvailable(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// MemAvailable:   12345678 kB
+		cols := strings.Fields(scanner.Text())
+		if len(cols) < 2 || cols[0] != "MemAvailable:" {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(cols[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("MemAvailable %w", err)
+		}
+		return kb * 1024, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("invalid meminfo file, MemAvailable not found")
+}
+
 type procStatus struct {
 	name      string
 	pid       string
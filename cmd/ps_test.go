@@ -122,6 +122,36 @@ func TestParseBootTime(t *testing.T) {
 	}
 }
 
+func TestParseLoadAverage(t *testing.T) {
+	r := strings.NewReader("3.52 2.10 1.05 2/1234 56789\n")
+
+	got, err := parseLoadAverage(r)
+	require.NoError(t, err)
+
+	if got != 3.52 {
+		t.Errorf("got %v want %v", got, 3.52)
+	}
+}
+
+func TestParseMemAvailable(t *testing.T) {
+	r := strings.NewReader(`MemTotal:       32597904 kB
+MemFree:         1206948 kB
+MemAvailable:   20423172 kB
+Buffers:          712584 kB
+`)
+
+	got, err := parseMemAvailable(r)
+	require.NoError(t, err)
+
+	var want uint64 = 20423172 * 1024
+	if got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	_, err = parseMemAvailable(strings.NewReader("MemTotal:       32597904 kB\n"))
+	require.Error(t, err)
+}
+
 func TestParseProcStat(t *testing.T) {
 	const clocktick = 100
 	cases := []struct {
@@ -8,347 +8,1349 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
 	"os/exec"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
-	"golang.org/x/sync/errgroup"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/tklauser/go-sysconf"
 )
 
 var (
 	errNoCommandSpecified = errors.New("no command specified")
 	errInvalidArgument    = errors.New("argument provided is invalid")
 	errMissingArgument    = errors.New("argument is required but not provided")
+	errArgLineTooLong     = errors.New("argument line too long")
+	errJobLogRequired     = errors.New("requires --joblog")
 )
 
 const zeroDelimiter = "\u0000"
-const newLineDelimiter = "\n"
+
+// exit statuses of xargs as defined by POSIX and GNU xargs
+const (
+	// an invocation of the command exited with status 1-125
+	exitStatusFailed = 123
+	// the command exited with status 255
+	exitStatusCommand255 = 124
+	// the command was killed by a signal
+	exitStatusSignaled = 125
+	// the command cannot be run
+	exitStatusCannotRun = 126
+	// the command was not found
+	exitStatusNotFound = 127
+)
+
+// time given to a timed out command to exit after SIGTERM before it is killed by SIGKILL,
+// and to processes it started to close its output after it exits, it is a variable for tests
+var timeoutGracePeriod = 5 * time.Second
 
 type xargsFlags struct {
+	// input items are separated by delimiter, if empty, by blanks honoring quotes and backslashes
 	delimiter   string
 	maxProcs    int
 	maxArgs     int
 	replacement string
-	exitOnError bool
+	// replace GNU parallel tokens like {} and {.} in the command, see tokenExpander
+	tokens bool
+	// when to stop starting new jobs or kill running ones, --exit-on-error is soon,fail=1
+	halt       haltPolicy
+	timeout    time.Duration
+	lineBuffer bool
+	keepOrder  bool
+	// maximum length of a command line, zero means the limit of the system
+	maxChars   int
+	showLimits bool
+	// maximum number of non-blank input lines per command line, zero means not limited by lines
+	maxLines    int
+	eofString   string
+	verbose     bool
+	interactive bool
+	// do not run the command if input is empty, by default it is run once without arguments from input
+	noRunIfEmpty bool
+	// read input from this file instead of stdin, stdin is then passed to commands
+	argFile string
+	joblog  string
+	resume  resumeMode
+	// prefix output lines of each job with its tag, tagString is the template of the tag
+	tag       bool
+	tagString string
+	// regular expression splitting input into columns for {1}, {2}...
+	colsep string
+	// pass input in blocks of blockSize bytes to stdin of commands instead of as arguments
+	pipe      bool
+	blockSize int
+	// do not start new jobs while load average is above maxLoad or available memory is below memFree
+	maxLoad float64
+	memFree uint64
+	// a failed job is run again at most retries times, waiting retryDelay doubled after each attempt
+	retries    int
+	retryDelay time.Duration
+	// print commands instead of running them
+	dryRun bool
+	// working directory of commands, replacement tokens are expanded for each job
+	workdir string
+	// KEY=VALUE pairs added to the environment of commands
+	env []string
+	// report progress on stderr, with an estimate of the remaining time for eta
+	progress bool
+	eta      bool
+	// directory, or .csv or .json file, output and results of jobs are saved to
+	results string
 }
 
 func newXargsFlags() *xargsFlags {
-	return &xargsFlags{delimiter: newLineDelimiter, maxProcs: 1, maxArgs: 1}
+	return &xargsFlags{maxProcs: 1, maxArgs: 1, blockSize: defaultBlockSize}
 }
 
-func (f *xargsFlags) parse(args []string) (rest []string, finished bool, err error) {
-	if len(args) == 0 {
-		return args, false, errNoCommandSpecified
+func init() {
+	rootCmd.AddCommand(newXargsCmd(runXargs))
+}
+
+// newXargsCmd returns the xargs command, which calls run with the command to run and the parsed flags
+func newXargsCmd(run func(args []string, flags *xargsFlags) error) *cobra.Command {
+	x := newXargsFlagSet()
+	cmd := &cobra.Command{
+		Use:   "xargs [flags] command [initial-arguments]",
+		Short: "Unix xargs command",
+		Long: `Build and run command lines from standard input.
+
+Flags are only parsed up to the command, everything after it, including its own flags,
+is passed to the command as is.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rest, err := x.parse(cmd.Flags(), args)
+			if err != nil {
+				return err
+			}
+			return run(rest, x.flags)
+		},
 	}
+	x.register(cmd.Flags())
+	return cmd
+}
 
-	flag := args[0]
-	switch flag {
-	case "-0":
+func runXargs(args []string, flags *xargsFlags) error {
+	if status := process(args, flags); status != 0 {
+		os.Exit(status)
+	}
+	return nil
+}
+
+// xargsFlagSet binds xargsFlags to command line flags. Flags whose values need to be validated or converted
+// are kept as given and parsed by parse, so that errors like errMissingArgument can be checked with errors.Is.
+type xargsFlagSet struct {
+	flags *xargsFlags
+
+	null         bool
+	exitOnError  bool
+	resume       bool
+	resumeFailed bool
+	// -i is the obsolete form of -I in xargs
+	replaceI   string
+	delimiter  string
+	maxLines   string
+	maxProcs   string
+	maxArgs    string
+	maxChars   string
+	timeout    string
+	retries    string
+	retryDelay string
+	halt       string
+	block      string
+	load       string
+	memFree    string
+}
+
+func newXargsFlagSet() *xargsFlagSet {
+	return &xargsFlagSet{flags: newXargsFlags()}
+}
+
+func (x *xargsFlagSet) register(fs *pflag.FlagSet) {
+	f := x.flags
+	// the first non-flag argument is the command, flags after it belong to the command
+	fs.SetInterspersed(false)
+
+	fs.BoolVarP(&x.null, "null", "0", false, "input items are terminated by a null character instead of by whitespace")
+	fs.StringVarP(&x.delimiter, "delimiter", "d", "", "input items are terminated by the specified character")
+	fs.StringVarP(&f.eofString, "eof", "E", "", "stop reading input at a line containing only the eof string")
+	fs.StringVarP(&x.maxLines, "max-lines", "L", "", "use at most `n` non-blank input lines per command line")
+	fs.StringVarP(&f.argFile, "arg-file", "a", "", "read items from `file` instead of standard input")
+	fs.BoolVarP(&f.noRunIfEmpty, "no-run-if-empty", "r", false, "do not run the command if input is empty")
+	fs.StringVarP(&f.replacement, "replace", "I", "", "replace the `string` in initial arguments with an input line, implies -n 1")
+	fs.StringVarP(&x.replaceI, "replace-i", "i", "", "same as -I")
+	fs.MarkHidden("replace-i")
+	fs.BoolVar(&f.tokens, "tokens", false, "replace tokens {} {.} {/} {//} {/.} {#} {%} {N} in the command with each input line, implies -n 1")
+	fs.StringVar(&f.colsep, "colsep", "", "split input into columns for {1}, {2}... by the `regexp`")
+	fs.BoolVar(&f.pipe, "pipe", false, "pass input in blocks to standard input of commands instead of as arguments")
+	fs.StringVar(&x.block, "block", "", "`size` of blocks passed to commands in pipe mode (default 1MiB)")
+	fs.BoolVarP(&f.verbose, "verbose", "t", false, "print command lines to standard error before running them")
+	fs.BoolVarP(&f.interactive, "interactive", "p", false, "ask before running each command line")
+	fs.BoolVar(&f.dryRun, "dry-run", false, "print command lines instead of running them")
+	fs.StringVarP(&f.workdir, "workdir", "C", "", "run commands in `dir`, replacement tokens are expanded")
+	fs.StringArrayVar(&f.env, "env", nil, "add `KEY=VALUE` to the environment of commands, can be repeated")
+	fs.BoolVar(&f.tag, "tag", false, "prefix output lines with the input of the job")
+	fs.StringVar(&f.tagString, "tagstring", "", "prefix output lines with the `template`, replacement tokens are expanded")
+	fs.StringVar(&f.joblog, "joblog", "", "log finished jobs to `file`")
+	fs.BoolVar(&x.resume, "resume", false, "skip jobs found in the joblog")
+	fs.BoolVar(&x.resumeFailed, "resume-failed", false, "skip jobs found in the joblog, but run failed ones again")
+	fs.StringVar(&f.results, "results", "", "save output and results of jobs to a directory, or a .csv or .json `file`")
+	fs.StringVarP(&x.maxProcs, "max-procs", "P", "", "run up to `n` processes at a time (default 1)")
+	fs.StringVarP(&x.maxArgs, "max-args", "n", "", "use at most `n` arguments per command line (default 1)")
+	fs.StringVarP(&x.maxChars, "max-chars", "s", "", "use at most `n` characters per command line")
+	fs.BoolVar(&f.showLimits, "show-limits", false, "show limits on command line length")
+	fs.BoolVar(&f.progress, "progress", false, "report progress on standard error")
+	fs.BoolVar(&f.eta, "eta", false, "report progress with an estimate of the remaining time on standard error")
+	fs.StringVar(&x.timeout, "timeout", "", "terminate commands running longer than `duration`")
+	fs.StringVar(&x.retries, "retries", "", "run a failed command again up to `n` times")
+	fs.StringVar(&x.retryDelay, "retry-delay", "", "wait `duration` before the first retry, doubled after each retry")
+	fs.StringVar(&x.halt, "halt", "", "when to stop after failed or successful jobs, e.g. soon,fail=1 or now,success=50%")
+	fs.BoolVar(&x.exitOnError, "exit-on-error", false, "stop starting new commands after a command fails, same as --halt soon,fail=1")
+	fs.StringVar(&x.load, "load", "", "do not start new commands while the load average is above `max-load`")
+	fs.StringVar(&x.memFree, "memfree", "", "do not start new commands while available memory is below `size`")
+	fs.BoolVar(&f.lineBuffer, "line-buffer", false, "write output of commands line by line instead of when they finish")
+	fs.BoolVarP(&f.keepOrder, "keep-order", "k", false, "write output of commands in input order")
+}
+
+// parse validates and converts the flags given on the command line, args are the arguments left after the flags,
+// which are the command and its arguments
+func (x *xargsFlagSet) parse(fs *pflag.FlagSet, args []string) ([]string, error) {
+	f := x.flags
+	var err error
+	if x.null {
 		f.delimiter = zeroDelimiter
-		return args[1:], false, nil
-	case "--exit-on-error":
-		f.exitOnError = true
-		return args[1:], false, nil
-	case "-n", "--max-args":
-		f.maxArgs, err = parseNumericArgument(args)
-		if err != nil {
-			return args, false, fmt.Errorf("-n, --max-args %w", err)
+	}
+	if fs.Changed("delimiter") {
+		if f.delimiter, err = parseDelimiter(x.delimiter); err != nil {
+			return args, fmt.Errorf("-d, --delimiter %w", err)
 		}
-		return args[2:], false, nil
-	case "-P", "--max-procs":
-		f.maxProcs, err = parseNumericArgument(args)
-		if err != nil {
-			return args, false, fmt.Errorf("-P, --max-procs %w", err)
+	}
+
+	numbers := []struct {
+		name  string
+		flag  string
+		value string
+		field *int
+	}{
+		{"max-lines", "-L, --max-lines", x.maxLines, &f.maxLines},
+		{"max-procs", "-P, --max-procs", x.maxProcs, &f.maxProcs},
+		{"max-args", "-n, --max-args", x.maxArgs, &f.maxArgs},
+		{"max-chars", "-s, --max-chars", x.maxChars, &f.maxChars},
+		{"retries", "--retries", x.retries, &f.retries},
+	}
+	for _, n := range numbers {
+		if !fs.Changed(n.name) {
+			continue
 		}
-		return args[2:], false, err
-	case "-I", "-i":
-		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
-			return args, false, fmt.Errorf("-I, -i %w", errMissingArgument)
+		if *n.field, err = parsePositiveInt(n.value); err != nil {
+			return args, fmt.Errorf("%s %w", n.flag, err)
 		}
-		f.replacement = args[1]
-		return args[2:], false, err
-	default:
-		// no recognized flag, so program and arguments must start
-		return args, true, nil
 	}
+
+	durations := []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"timeout", x.timeout, &f.timeout},
+		{"retry-delay", x.retryDelay, &f.retryDelay},
+	}
+	for _, d := range durations {
+		if !fs.Changed(d.name) {
+			continue
+		}
+		if *d.field, err = parsePositiveDuration(d.value); err != nil {
+			return args, fmt.Errorf("--%s %w", d.name, err)
+		}
+	}
+
+	if fs.Changed("replace-i") {
+		f.replacement = x.replaceI
+	}
+	if (fs.Changed("replace") || fs.Changed("replace-i")) && strings.HasPrefix(f.replacement, "-") {
+		return args, fmt.Errorf("-I, -i %w", errMissingArgument)
+	}
+
+	if fs.Changed("colsep") {
+		if _, err := regexp.Compile(f.colsep); err != nil {
+			return args, fmt.Errorf("--colsep %w %s", errInvalidArgument, err)
+		}
+	}
+
+	if fs.Changed("block") {
+		size, err := humanize.ParseBytes(x.block)
+		if err != nil || size == 0 || size > math.MaxInt32 {
+			return args, fmt.Errorf("--block %w", errInvalidArgument)
+		}
+		f.blockSize = int(size)
+	}
+
+	for _, kv := range f.env {
+		if key, _, found := strings.Cut(kv, "="); !found || len(key) == 0 {
+			return args, fmt.Errorf("--env %w, it must be KEY=VALUE", errInvalidArgument)
+		}
+	}
+
+	if fs.Changed("tagstring") {
+		f.tag = true
+	}
+
+	if x.exitOnError {
+		f.halt = haltPolicy{when: haltSoon, count: 1}
+	}
+	if fs.Changed("halt") {
+		if f.halt, err = parseHaltPolicy(x.halt); err != nil {
+			return args, fmt.Errorf("--halt %w", err)
+		}
+	}
+
+	if fs.Changed("load") {
+		f.maxLoad, err = strconv.ParseFloat(x.load, 64)
+		if err != nil || f.maxLoad <= 0 {
+			return args, fmt.Errorf("--load %w", errInvalidArgument)
+		}
+	}
+	if fs.Changed("memfree") {
+		if f.memFree, err = parseMemFree(x.memFree); err != nil {
+			return args, fmt.Errorf("--memfree %w", err)
+		}
+	}
+
+	if x.resume {
+		f.resume = resumeAll
+	}
+	if x.resumeFailed {
+		f.resume = resumeFailed
+	}
+
+	if len(args) == 0 {
+		return args, errNoCommandSpecified
+	}
+
+	if f.resume != resumeNone && len(f.joblog) == 0 {
+		return args, fmt.Errorf("--resume, --resume-failed %w", errJobLogRequired)
+	}
+
+	if len(f.replacement) != 0 || f.tokens {
+		// when a replacement char is provided, parameter -n/--max-args is
+		// set to one in original xargs, so we follow that convention
+		f.maxArgs = 1
+	}
+
+	return args, nil
 }
 
-func parseNumericArgument(args []string) (int, error) {
-	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+func parsePositiveInt(s string) (int, error) {
+	if strings.HasPrefix(s, "-") {
+		// a flag is given instead of the argument
 		return 0, errMissingArgument
 	}
-	n, err := strconv.Atoi(args[1])
+	n, err := strconv.Atoi(s)
 	if err != nil || n < 1 {
 		return 0, errInvalidArgument
 	}
 	return n, nil
 }
 
-func (f *xargsFlags) parseFlags(args []string) ([]string, error) {
-	finished := false
-	var err error
-	for !finished {
-		args, finished, err = f.parse(args)
-		if err != nil {
-			return args, err
-		}
+func parsePositiveDuration(s string) (time.Duration, error) {
+	if strings.HasPrefix(s, "-") {
+		return 0, errMissingArgument
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errInvalidArgument
 	}
+	return d, nil
+}
 
-	if len(f.replacement) != 0 {
-		// when a replacement char is provided, parameter -n/--max-args is
-		// set to one in original xargs, so we follow that convention
-		f.maxArgs = 1
+// xargsJob is a single command invocation
+type xargsJob struct {
+	// position of the job in the input order, starting from 1
+	seq int
+	// command and its arguments
+	args []string
+	// arguments of the command read from input
+	input []string
+	// slot of the job for {%} and XARGS_SLOT, given by the scheduler when the job is started
+	slot int
+	// command and its arguments containing {%}, args are expanded again once the slot of the job is known
+	template []string
+	// in pipe mode, the block of input written to stdin of the command
+	block []byte
+}
+
+// jobOutput is a piece of stdout or stderr output of a job.
+// The last output of every job has done set, so that the end of a job can be detected,
+// it also carries the exit status of the job (see exitStatusOf).
+// Messages not belonging to any job have zero seq.
+type jobOutput struct {
+	seq    int
+	data   string
+	stderr bool
+	done   bool
+	status int
+}
+
+// runOptions contains settings applied to every command invocation
+type runOptions struct {
+	timeout    time.Duration
+	lineBuffer bool
+	// print command lines to stderr before running them
+	verbose bool
+	// if not nil, user is asked to confirm each command line
+	prompt *prompter
+	// stdin of commands, nil means the null device
+	stdin io.Reader
+	// if not nil, finished jobs are logged to it
+	joblog *jobLog
+	// sequence numbers of jobs not to run, since they were run on a previous run
+	skip map[int]bool
+	// if not empty, output lines are prefixed with this template expanded for the job, see expandTag
+	tagString string
+	tokens    *tokenExpander
+	// running commands are signaled to exit when it is triggered
+	kill *killSwitch
+	// run each command in its own process group, so that a timed out or halted command can be killed
+	// together with the processes it started. Otherwise commands stay in the process group of xargs,
+	// so that they can use the terminal as foreground jobs and get its signals, as in GNU xargs.
+	processGroup bool
+	// if not nil, starting jobs is delayed while the system is busy
+	resources *resourceGate
+	// number of times a failed job is run again and the delay before the first retry, which doubles after each retry
+	retries    int
+	retryDelay time.Duration
+	dryRun     bool
+	// working directory template of commands, empty means the working directory of xargs
+	workdir string
+	// added to the environment of commands
+	env []string
+	// if not nil, jobs are counted on it
+	progress *progress
+	// if not nil, output and results of jobs are saved to it
+	results resultStore
+}
+
+// prompter asks the user whether a command should be run, prompts of parallel jobs are serialized
+type prompter struct {
+	mu     sync.Mutex
+	answer *bufio.Reader
+	out    io.Writer
+}
+
+func newPrompter(tty io.Reader, out io.Writer) *prompter {
+	return &prompter{answer: bufio.NewReader(tty), out: out}
+}
+
+// confirm prints the command line followed by a question and reports whether the answer starts with 'y' or 'Y'
+func (p *prompter) confirm(commandLine string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.out, "%s ?...", commandLine)
+	answer, err := p.answer.ReadString('\n')
+	if err != nil && len(answer) == 0 {
+		return false
 	}
 
-	return args, nil
+	return strings.HasPrefix(answer, "y") || strings.HasPrefix(answer, "Y")
+}
+
+// shouldRunJob traces and asks for confirmation of the job as requested in the options,
+// it returns false if the job should be skipped
+func shouldRunJob(job *xargsJob, opts runOptions, outch chan<- jobOutput) bool {
+	if opts.skip[job.seq] {
+		return false
+	}
+
+	if opts.prompt != nil {
+		// prompt contains the command line already, no need to trace it
+		return opts.prompt.confirm(shellQuote(job.args))
+	}
+
+	if opts.verbose {
+		outch <- jobOutput{seq: job.seq, data: shellQuote(job.args) + "\n", stderr: true}
+	}
+	return true
+}
+
+// shellQuote joins the arguments to a command line that can be pasted to a shell,
+// arguments containing special characters are single quoted
+func shellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
 }
 
-func ExecuteXargs() {
-	if len(os.Args) == 1 {
-		fmt.Println("Usage: {} xargs [-I <replacement>] [-P <max-procs>] [-n <max-args] <command> [args]\n", os.Args[0])
+func shellQuoteArg(arg string) string {
+	if len(arg) == 0 {
+		return "''"
+	}
+
+	safe := true
+	for _, c := range arg {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_@%+=:,./-", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// jobRunner runs a job and reports its output and result to outch
+type jobRunner struct {
+	outch  chan<- jobOutput
+	stopch <-chan struct{}
+	stop   func()
+	opts   runOptions
+	halter *halter
+}
+
+func (r *jobRunner) runJob(job *xargsJob) {
+	if job.template != nil {
+		job.args = r.opts.tokens.expandArgs(job.template, job)
+	}
+
+	if r.opts.resources != nil && !r.opts.skip[job.seq] {
+		r.opts.resources.wait(r.stopch)
+	}
+
+	if isStopped(r.stopch) || !shouldRunJob(job, r.opts, r.outch) {
+		// still mark the job done, so that jobs are accounted for
+		r.opts.progress.jobSkipped()
+		r.outch <- jobOutput{seq: job.seq, done: true}
+		return
+	}
+
+	if r.opts.dryRun {
+		r.outch <- jobOutput{seq: job.seq, data: dryRunCommandLine(job, r.opts) + "\n"}
+		r.opts.progress.jobSkipped()
+		r.outch <- jobOutput{seq: job.seq, done: true}
 		return
 	}
 
-	flags := newXargsFlags()
-	rest, err := flags.parseFlags(os.Args[2:])
+	r.opts.progress.jobStarted()
+	result, err := r.runWithRetries(job)
+	r.opts.progress.jobFinished(result.runtime, err != nil)
+	if isFatalExitStatus(result.status) {
+		r.stop()
+	}
+	if !result.killed {
+		r.halter.record(err != nil)
+	}
+	logJob(job, result, r.opts, r.outch)
+	saveResult(job, result, r.opts, r.outch)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "An error occurred: %s\n", err)
+		r.outch <- jobOutput{seq: job.seq, data: err.Error() + "\n", stderr: true}
+	}
+	r.outch <- jobOutput{seq: job.seq, done: true, status: result.status}
+}
+
+// runWithRetries runs the job, and if it fails, runs it again as many times as requested with exponential backoff.
+// Attempts are reported to stderr, the result of the final attempt is returned.
+func (r *jobRunner) runWithRetries(job *xargsJob) (jobResult, error) {
+	delay := r.opts.retryDelay
+	for attempt := 1; ; attempt++ {
+		result, err := runProgram(job, r.opts, r.outch)
+		if err == nil || result.killed || attempt > r.opts.retries || !isRetryableExitStatus(result.status) {
+			return result, err
+		}
+
+		r.outch <- jobOutput{seq: job.seq, data: fmt.Sprintf("attempt %d of %d failed, retrying in %s: %s\n", attempt, r.opts.retries+1, delay, err), stderr: true}
+		select {
+		case <-r.stopch:
+			return result, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isRetryableExitStatus reports whether a job with the status may succeed when it is run again,
+// a command that cannot be run or exits with 255 to stop xargs is not retried
+func isRetryableExitStatus(status int) bool {
+	return status == exitStatusFailed || status == exitStatusSignaled
+}
+
+// logJob writes the job to the job log if it is requested, errors are reported as messages
+func logJob(job *xargsJob, result jobResult, opts runOptions, outch chan<- jobOutput) {
+	if opts.joblog == nil {
 		return
 	}
 
-	process(rest, flags)
+	if err := opts.joblog.write(job, result); err != nil {
+		outch <- jobOutput{data: fmt.Sprintf("cannot write job log %s\n", err), stderr: true}
+	}
 }
 
-type cmdRunner interface {
-	runAsync(argch <-chan []string)
-	waitAsync()
+// closeResultOutput closes the writers output of a job is saved to, errors are reported as messages
+func closeResultOutput(outch chan<- jobOutput, writers ...io.WriteCloser) {
+	for _, w := range writers {
+		if err := w.Close(); err != nil {
+			outch <- jobOutput{data: fmt.Sprintf("cannot save results %s\n", err), stderr: true}
+		}
+	}
 }
 
-type regularRunner struct {
-	wg    sync.WaitGroup
-	outch chan<- string
-	errch chan<- string
+// saveResult saves output and result of the job if it is requested, errors are reported as messages
+func saveResult(job *xargsJob, result jobResult, opts runOptions, outch chan<- jobOutput) {
+	if opts.results == nil {
+		return
+	}
+
+	if err := opts.results.save(job, result); err != nil {
+		outch <- jobOutput{data: fmt.Sprintf("cannot save results %s\n", err), stderr: true}
+	}
 }
 
-func (r *regularRunner) runAsync(argch <-chan []string) {
-	r.wg.Add(1)
-	go func() {
-		err := r.runProgram(argch)
-		if err != nil {
-			fmt.Printf("error: %s", err)
+func isStopped(stopch <-chan struct{}) bool {
+	select {
+	case <-stopch:
+		return true
+	default:
+		return false
+	}
+}
+
+// output of a command is forwarded in chunks of at most this size,
+// also a line longer than this is forwarded partially in line buffered mode
+const streamChunkSize = 32 * 1024
+
+// streamWriter forwards output of a command to a channel as it is written.
+// In line buffered mode, only complete lines are forwarded until the command finishes,
+// so that partial lines of commands running in parallel are not mixed with each other.
+// Data is forwarded unmodified, so binary output passes through as is.
+type streamWriter struct {
+	ch         chan<- jobOutput
+	seq        int
+	stderr     bool
+	lineBuffer bool
+	buf        []byte
+	// if not empty, every line is prefixed with it
+	tag string
+	// whether the last forwarded data ended in the middle of a line, so that the rest of the line is not tagged
+	midLine bool
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if !s.lineBuffer {
+		s.send(string(p))
+		return len(p), nil
+	}
+
+	s.buf = append(s.buf, p...)
+	i := bytes.LastIndexByte(s.buf, '\n')
+	if i < 0 && len(s.buf) < streamChunkSize {
+		return len(p), nil
+	}
+
+	if i < 0 {
+		// too long line, forward what we have so far instead of buffering indefinitely
+		i = len(s.buf) - 1
+	}
+	s.send(string(s.buf[:i+1]))
+	s.buf = append(s.buf[:0], s.buf[i+1:]...)
+	return len(p), nil
+}
+
+func (s *streamWriter) send(data string) {
+	if len(s.tag) != 0 {
+		data = s.tagLines(data)
+	}
+	s.ch <- jobOutput{seq: s.seq, data: data, stderr: s.stderr}
+}
+
+func (s *streamWriter) tagLines(data string) string {
+	var tagged strings.Builder
+	for _, line := range strings.SplitAfter(data, "\n") {
+		if len(line) == 0 {
+			continue
 		}
-		r.wg.Done()
-	}()
+		if !s.midLine {
+			tagged.WriteString(s.tag)
+		}
+		tagged.WriteString(line)
+		s.midLine = !strings.HasSuffix(line, "\n")
+	}
+	return tagged.String()
 }
 
-func (r *regularRunner) waitAsync() {
-	r.wg.Wait()
-	close(r.outch)
+// expandTag returns the tag of the job, that is the template with its replacement tokens expanded.
+// A tag is separated from the output line by a tab, as GNU parallel does.
+func expandTag(template string, job *xargsJob, tokens *tokenExpander) string {
+	return tokens.expand(template, job) + "\t"
 }
 
-func (r *regularRunner) runProgram(argch <-chan []string) error {
-	for {
-		commandAndArgs, open := <-argch
-		if !open {
-			return nil
+// flush forwards remaining partial line, if any
+func (s *streamWriter) flush() {
+	if len(s.buf) != 0 {
+		s.send(string(s.buf))
+		s.buf = s.buf[:0]
+	}
+}
+
+// jobResult is the outcome of running the command of a job
+type jobResult struct {
+	// exit code of the command, -1 if it could not be started or was killed by a signal
+	exitCode int
+	// signal that killed the command, zero if it exited normally
+	signal syscall.Signal
+	// exit status of xargs for this job, see exitStatusOf
+	status  int
+	start   time.Time
+	runtime time.Duration
+	// the command was killed since xargs halted, see halter
+	killed bool
+}
+
+// runProgram runs the command of the job, streaming its stdout and stderr to outch.
+// The job failed if the returned error is not nil, in which case the error describes why e.g. the command
+// exited with a non-zero status, could not be started or timed out. Output of the command,
+// including its stderr, is not considered while deciding whether the job failed.
+func runProgram(job *xargsJob, opts runOptions, outch chan<- jobOutput) (jobResult, error) {
+	commandAndArgs := job.args
+	command := exec.Command(commandAndArgs[0], commandAndArgs[1:]...)
+	command.Stdin = opts.stdin
+	if job.block != nil {
+		command.Stdin = bytes.NewReader(job.block)
+	}
+	command.Dir = commandDir(job, opts)
+	// processes started by the command, e.g. in the background, may keep its output open after it exits.
+	// They are not waited for longer than the grace period, since they may not be killed with the command,
+	// unless it runs in its own process group.
+	command.WaitDelay = timeoutGracePeriod
+	command.Env = append(os.Environ(), opts.env...)
+	command.Env = append(command.Env, jobEnv(job)...)
+	var tag string
+	if len(opts.tagString) != 0 {
+		tag = expandTag(opts.tagString, job, opts.tokens)
+	}
+	stdout := &streamWriter{ch: outch, seq: job.seq, lineBuffer: opts.lineBuffer, tag: tag}
+	command.Stdout = stdout
+	stderr := &streamWriter{ch: outch, seq: job.seq, stderr: true, lineBuffer: opts.lineBuffer, tag: tag}
+	command.Stderr = stderr
+	if opts.results != nil {
+		resultStdout, resultStderr, err := opts.results.output(job)
+		if err != nil {
+			outch <- jobOutput{data: fmt.Sprintf("cannot save results %s\n", err), stderr: true}
+		} else {
+			defer closeResultOutput(outch, resultStdout, resultStderr)
+			command.Stdout = io.MultiWriter(stdout, resultStdout)
+			command.Stderr = io.MultiWriter(stderr, resultStderr)
 		}
+	}
+	if opts.processGroup {
+		command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	start := time.Now()
+	if err := command.Start(); err != nil {
+		return jobResult{exitCode: -1, status: exitStatusOf(err), start: start}, err
+	}
 
-		stdout, stderr := runProgram(commandAndArgs)
-		if len(stderr) != 0 {
-			r.errch <- stderr
-			continue
+	outcome, err := waitWithTimeout(command, opts.timeout, opts.kill)
+	stdout.flush()
+	stderr.flush()
+	result := jobResult{exitCode: command.ProcessState.ExitCode(), status: exitStatusOf(err), start: start, runtime: time.Since(start)}
+	if status, ok := command.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.signal = status.Signal()
+	}
+
+	commandLine := strings.Join(commandAndArgs, " ")
+	switch {
+	case outcome == waitKilled:
+		// killed by xargs, its failure is caused by another job
+		result.status = 0
+		result.killed = true
+		return result, nil
+	case outcome == waitTimedOut:
+		// a timed out command is killed by xargs, it is a failure rather than being killed by a signal
+		result.status = exitStatusFailed
+		return result, fmt.Errorf("timed out after %s: %s", opts.timeout, commandLine)
+	case result.signal != 0:
+		return result, fmt.Errorf("killed by signal %d (%s): %s", result.signal, result.signal, commandLine)
+	case result.exitCode != 0:
+		return result, fmt.Errorf("exited with status %d: %s", result.exitCode, commandLine)
+	}
+
+	return result, nil
+}
+
+// commandDir returns the working directory of the command of the job, empty means the working directory of xargs
+func commandDir(job *xargsJob, opts runOptions) string {
+	if len(opts.workdir) == 0 {
+		return ""
+	}
+	return opts.tokens.expand(opts.workdir, job)
+}
+
+// jobEnv returns the variables added to the environment of every command, as --process-slot-var
+// of GNU xargs, commands can tell which slot and job they run in
+func jobEnv(job *xargsJob) []string {
+	return []string{"XARGS_SLOT=" + strconv.Itoa(job.slot), "XARGS_JOB=" + strconv.Itoa(job.seq)}
+}
+
+// maxJobEnvSize is the size jobEnv can take at most, which is reserved on the command line length
+var maxJobEnvSize = commandLineLength(jobEnv(&xargsJob{slot: math.MaxInt, seq: math.MaxInt}))
+
+// dryRunCommandLine returns the command line of the job as it would be run, changing to its working
+// directory and adding --env variables, so that it can be pasted to a shell
+func dryRunCommandLine(job *xargsJob, opts runOptions) string {
+	var line strings.Builder
+	if dir := commandDir(job, opts); len(dir) != 0 {
+		line.WriteString("cd " + shellQuoteArg(dir) + " && ")
+	}
+	for _, kv := range opts.env {
+		// only the value is quoted, otherwise it is not an assignment for the shell
+		key, value, _ := strings.Cut(kv, "=")
+		line.WriteString(key + "=" + shellQuoteArg(value) + " ")
+	}
+	line.WriteString(shellQuote(job.args))
+	return line.String()
+}
+
+// exitStatusOf maps the error of starting or waiting a command to an exit status of xargs
+func exitStatusOf(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return exitStatusSignaled
 		}
+		if exitErr.ExitCode() == 255 {
+			return exitStatusCommand255
+		}
+		return exitStatusFailed
+	}
 
-		r.outch <- stdout
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return exitStatusNotFound
 	}
+
+	return exitStatusCannotRun
 }
 
-type runnerOnExit struct {
-	errg  *errgroup.Group
-	errch chan string
-	outch chan<- string
+// isFatalExitStatus reports whether xargs should stop reading input after a command exits with the status
+func isFatalExitStatus(status int) bool {
+	return status > exitStatusFailed
 }
 
-func (r *runnerOnExit) runAsync(argch <-chan []string) {
-	r.errg.Go(func() error {
-		return r.runProgram(argch)
-	})
+// waitOutcome tells how waiting for a command ended
+type waitOutcome int
+
+const (
+	// the command exited by itself
+	waitExited waitOutcome = iota
+	waitTimedOut
+	// the command was killed since kill channel was closed
+	waitKilled
+)
+
+// waitWithTimeout waits for the started command to finish. If it does not finish in time, it is sent SIGTERM,
+// or the signal of kill when it is triggered, and then SIGKILL after timeoutGracePeriod, see signalCommand.
+// A zero timeout means waiting without a limit.
+func waitWithTimeout(command *exec.Cmd, timeout time.Duration, kill *killSwitch) (waitOutcome, error) {
+	done := make(chan error, 1)
+	go func() {
+		err := command.Wait()
+		if errors.Is(err, exec.ErrWaitDelay) {
+			// the command succeeded, only its output was closed after WaitDelay
+			err = nil
+		}
+		done <- err
+	}()
+
+	var timer <-chan time.Time
+	if timeout != 0 {
+		timer = time.After(timeout)
+	}
+
+	outcome, sig := waitTimedOut, syscall.SIGTERM
+	select {
+	case err := <-done:
+		return waitExited, err
+	case <-timer:
+	case <-kill.done():
+		outcome, sig = waitKilled, kill.signal()
+	}
+
+	signalCommand(command, sig)
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeoutGracePeriod):
+		signalCommand(command, syscall.SIGKILL)
+		err = <-done
+	}
+
+	return outcome, err
 }
 
-func (r *runnerOnExit) waitAsync() {
-	if err := r.errg.Wait(); err != nil {
-		r.errch <- fmt.Sprint(err)
+// signalCommand sends sig to the whole process group of a command running in its own group, and only to the
+// command itself otherwise, since its process group is the one of xargs
+func signalCommand(command *exec.Cmd, sig syscall.Signal) {
+	if command.SysProcAttr != nil && command.SysProcAttr.Setpgid {
+		syscall.Kill(-command.Process.Pid, sig)
+		return
 	}
+	command.Process.Signal(sig)
+}
 
-	close(r.errch)
-	close(r.outch)
+// in keep order mode, at most this many jobs per process can be started ahead of
+// the job whose output is being written, which bounds the buffered output
+const keepOrderWindow = 4
+
+// outputOrderer writes outputs of jobs in input order. Output of the oldest unfinished job
+// is written as it arrives, outputs of the others are buffered until all previous jobs are finished.
+type outputOrderer struct {
+	next    int
+	pending map[int][]jobOutput
+	write   func(jobOutput)
+	// a token is taken from window for every job emitted
+	window <-chan struct{}
 }
 
-func (r *runnerOnExit) runProgram(argch <-chan []string) error {
-	for {
-		commandAndArgs, open := <-argch
-		if !open {
-			return nil
+func newOutputOrderer(write func(jobOutput), window <-chan struct{}) *outputOrderer {
+	return &outputOrderer{next: 1, pending: make(map[int][]jobOutput), write: write, window: window}
+}
+
+func (o *outputOrderer) add(out jobOutput) {
+	if out.seq != o.next && out.seq != 0 {
+		o.pending[out.seq] = append(o.pending[out.seq], out)
+		return
+	}
+
+	o.write(out)
+	for out.done {
+		o.next++
+		<-o.window
+
+		buffered := o.pending[o.next]
+		delete(o.pending, o.next)
+		out = jobOutput{}
+		for _, b := range buffered {
+			o.write(b)
+			out = b
 		}
+	}
+}
 
-		stdout, stderr := runProgram(commandAndArgs)
-		if len(stderr) != 0 {
-			r.errch <- stderr
-			return fmt.Errorf("error: %s", stderr)
+// limitJobs forwards jobs from argch to the returned channel, but waits for a free slot in window
+// for each job, so that jobs are not started too far ahead of the job whose output is being written
+func limitJobs(argch <-chan *xargsJob, window chan<- struct{}) <-chan *xargsJob {
+	limited := make(chan *xargsJob)
+	go func() {
+		for job := range argch {
+			window <- struct{}{}
+			limited <- job
 		}
+		close(limited)
+	}()
+	return limited
+}
 
-		r.outch <- stdout
+func writeJobOutput(out jobOutput) {
+	if out.stderr {
+		os.Stderr.WriteString(out.data)
+		return
 	}
+	os.Stdout.WriteString(out.data)
 }
 
-func runProgram(commandAndArgs []string) (stdout string, stderr string) {
-	command := exec.Command(commandAndArgs[0], commandAndArgs[1:]...)
-	command.Stdin, _ = os.Open(os.DevNull)
-	var out strings.Builder
-	command.Stdout = &out
-	var errout strings.Builder
-	command.Stderr = &errout
-	err := command.Run()
+// space left free from ARG_MAX, as GNU xargs does
+const argMaxHeadroom = 2048
+
+// smallest ARG_MAX allowed by POSIX
+const posixArgMax = 4096
+
+// command line length used unless a larger one is requested with -s, as GNU xargs does.
+// ARG_MAX also has to hold a pointer for each argument, so using all of it can still fail with E2BIG
+const defaultMaxChars = 128 * 1024
+
+// commandLineLength returns the space a command line takes, each argument is terminated with a NUL
+func commandLineLength(args []string) int {
+	n := 0
+	for _, arg := range args {
+		n += len(arg) + 1
+	}
+	return n
+}
+
+// systemMaxChars returns the maximum command line length that can be used on this system,
+// that is ARG_MAX minus the space the environment variables of commands take and some headroom.
+// The environment of commands is the one of xargs, extraEnv and the variables of jobEnv.
+func systemMaxChars(extraEnv []string) (argMax int, envSize int, maxChars int, err error) {
+	limit, err := sysconf.Sysconf(sysconf.SC_ARG_MAX)
 	if err != nil {
-		return "", errout.String()
+		return 0, 0, 0, err
 	}
 
-	return out.String(), ""
+	argMax = int(limit)
+	envSize = commandLineLength(os.Environ()) + commandLineLength(extraEnv) + maxJobEnvSize
+	maxChars = max(argMax-envSize-argMaxHeadroom, posixArgMax-argMaxHeadroom)
+	return argMax, envSize, maxChars, nil
 }
 
-func process(args []string, flags *xargsFlags) {
-	scanner := bufio.NewScanner(os.Stdin)
-	if flags.delimiter == zeroDelimiter {
-		scanner.Split(splitByZero)
+// commandLineLimit returns the maximum command line length to use, which is requested or defaultMaxChars,
+// capped with the limit of the system. extraEnv are the variables added to the environment of commands.
+// When show is set, limits are printed to stderr.
+func commandLineLimit(requested int, show bool, extraEnv []string) (int, error) {
+	argMax, envSize, maxChars, err := systemMaxChars(extraEnv)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read ARG_MAX %w", err)
 	}
-	argch := make(chan []string, flags.maxProcs)
-	outch := make(chan string, flags.maxProcs)
-	errch := make(chan string, flags.maxProcs)
 
-	var runner cmdRunner
+	limit := min(defaultMaxChars, maxChars)
+	if requested != 0 {
+		limit = min(requested, maxChars)
+	}
+
+	if requested > maxChars {
+		fmt.Fprintf(os.Stderr, "value %d for -s option should be < %d, using %d instead\n", requested, maxChars+1, maxChars)
+	}
+
+	if show {
+		fmt.Fprintf(os.Stderr, "Your environment variables take up %d bytes\n", envSize)
+		fmt.Fprintf(os.Stderr, "POSIX upper limit on argument length (this system): %d\n", argMax)
+		fmt.Fprintf(os.Stderr, "POSIX smallest allowable upper limit on argument length (all systems): %d\n", posixArgMax)
+		fmt.Fprintf(os.Stderr, "Maximum length of command we could actually use: %d\n", maxChars)
+		fmt.Fprintf(os.Stderr, "Size of command buffer we are actually using: %d\n", limit)
+	}
+
+	return limit, nil
+}
+
+// process runs the command for the input read from stdin or the argument file and returns the exit status of xargs
+func process(args []string, flags *xargsFlags) int {
+	maxChars, err := commandLineLimit(flags.maxChars, flags.showLimits, flags.env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurred: %s\n", err)
+		return 1
+	}
 
-	if flags.exitOnError {
-		runner = &runnerOnExit{
-			errg: new(errgroup.Group), outch: outch, errch: errch,
+	if commandLineLength(args) > maxChars {
+		fmt.Fprintf(os.Stderr, "An error occurred: %s\n", errArgLineTooLong)
+		return 1
+	}
+
+	var input io.Reader = os.Stdin
+	var commandStdin io.Reader
+	if len(flags.argFile) != 0 && flags.argFile != "-" {
+		f, err := os.Open(flags.argFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurred: cannot open input file %s\n", err)
+			return 1
 		}
-	} else {
-		runner = &regularRunner{
-			outch: outch, wg: sync.WaitGroup{}, errch: errch,
+		defer f.Close()
+		input = f
+		// stdin is not used for input, so commands can use it
+		commandStdin = os.Stdin
+	}
+
+	scanner := &countingArgScanner{lineArgScanner: newArgScanner(input, flags)}
+	argch := make(chan *xargsJob, flags.maxProcs)
+	outch := make(chan jobOutput, flags.maxProcs)
+
+	// closing exitch stops reading input and starting new commands
+	exitch := make(chan struct{})
+	stop := sync.OnceFunc(func() { close(exitch) })
+
+	var skip map[int]bool
+	if flags.resume != resumeNone {
+		skip, err = readJobLogFile(flags.joblog, flags.resume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurred: cannot read job log %s\n", err)
+			return 1
 		}
 	}
 
-	for i := 0; i < flags.maxProcs; i++ {
-		runner.runAsync(argch)
+	var joblog *jobLog
+	if len(flags.joblog) != 0 {
+		f, l, err := openJobLog(flags.joblog, flags.resume != resumeNone)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurred: cannot open job log %s\n", err)
+			return 1
+		}
+		defer f.Close()
+		joblog = l
 	}
 
-	exitch := make(chan struct{})
+	var results resultStore
+	if len(flags.results) != 0 {
+		results, err = newResultStore(flags.results)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurred: cannot open results %s\n", err)
+			return 1
+		}
+		defer results.Close()
+	}
+
+	var colsep *regexp.Regexp
+	if len(flags.colsep) != 0 {
+		// validated while parsing flags
+		colsep = regexp.MustCompile(flags.colsep)
+	}
+	tokens := newTokenExpander(flags.replacement, flags.tokens, colsep)
+	// input replaces tokens in the command instead of being appended to it
+	replacing := tokens.replacesArgs()
+
+	opts := runOptions{timeout: flags.timeout, lineBuffer: flags.lineBuffer, verbose: flags.verbose, stdin: commandStdin, joblog: joblog, skip: skip, tokens: tokens,
+		retries: flags.retries, retryDelay: flags.retryDelay, dryRun: flags.dryRun, workdir: flags.workdir, env: flags.env, results: results,
+		processGroup: flags.timeout != 0 || flags.halt.when == haltNow}
+	if flags.tag {
+		opts.tagString = flags.tagString
+		if len(opts.tagString) == 0 {
+			opts.tagString = "{}"
+		}
+		// lines of parallel jobs must not be mixed, otherwise tags would be in the middle of lines
+		opts.lineBuffer = true
+	}
+	if flags.interactive {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurred: cannot open /dev/tty %s\n", err)
+			return 1
+		}
+		defer tty.Close()
+		opts.prompt = newPrompter(tty, os.Stderr)
+	}
+
+	if flags.maxLoad != 0 || flags.memFree != 0 {
+		opts.resources = newResourceGate(flags.maxLoad, flags.memFree, os.Stderr)
+	}
+
+	kill := newKillSwitch()
+	opts.kill = kill
+	halter := newHalter(flags.halt, stop, func() { kill.kill(syscall.SIGTERM) })
 
-	if flags.maxArgs == 1 {
-		go passBySingle(scanner, args, argch, exitch, flags.replacement)
+	var runch <-chan *xargsJob = argch
+	progressDone := make(chan struct{})
+	reportFinished := make(chan struct{})
+	if flags.progress || flags.eta {
+		opts.progress = newProgress(flags.eta, os.Stderr)
+		runch = opts.progress.countJobs(runch)
+		go opts.progress.report(reportFinished, progressDone)
 	} else {
-		go passByMultiple(scanner, args, argch, exitch, flags.maxArgs)
+		close(progressDone)
 	}
+	runner := &jobRunner{outch: outch, stopch: exitch, stop: stop, opts: opts, halter: halter}
 
-	go runner.waitAsync()
+	write := writeJobOutput
+	if flags.keepOrder {
+		window := make(chan struct{}, keepOrderWindow*flags.maxProcs)
+		runch = limitJobs(runch, window)
+		write = newOutputOrderer(writeJobOutput, window).add
+	}
 
-loop:
-	for {
-		select {
-		case err, open := <-errch:
-			if !open {
-				close(exitch)
-				break loop
-			}
+	finished := make(chan struct{})
+	defer close(finished)
+	interrupted := newInterruption()
+	handleInterruptSignals(interrupted, stop, kill, finished)
+	sched := newScheduler(flags.maxProcs)
+	handleResizeSignals(sched, finished)
 
-			fmt.Fprintf(os.Stderr, "%s\n", strings.TrimSuffix(err, "\n"))
+	inputErr := make(chan error, 1)
+	go func() {
+		defer close(argch)
+		var err error
+		if flags.pipe {
+			err = passByBlocks(input, args, argch, exitch, flags.blockSize, recordDelimiter(flags))
+		} else if replacing {
+			err = passBySingle(scanner, args, argch, exitch, tokens, maxChars)
+		} else if flags.maxLines != 0 {
+			err = passByLines(scanner, args, argch, exitch, flags.maxLines, maxChars)
+		} else if flags.maxArgs == 1 {
+			err = passBySingle(scanner, args, argch, exitch, nil, maxChars)
+		} else {
+			err = passByMultiple(scanner, args, argch, exitch, flags.maxArgs, maxChars)
+		}
 
-		case out, open := <-outch:
-			if !open {
-				close(exitch)
-				break loop
-			}
-			fmt.Printf("%s\n", strings.TrimSuffix(out, "\n"))
+		// as GNU xargs, command is run once when there is no input, unless there is a replacement
+		if err == nil && scanner.count == 0 && !flags.noRunIfEmpty && !replacing && !flags.pipe {
+			argch <- &xargsJob{seq: 1, args: args}
+		}
+		inputErr <- err
+	}()
+
+	go func() {
+		sched.run(runch, interrupted.ch, runner.runJob)
+		close(outch)
+	}()
+
+	status := 0
+	for out := range outch {
+		if out.done {
+			// the most severe status is reported
+			status = max(status, out.status)
 		}
+		write(out)
 	}
 
+	close(reportFinished)
+	<-progressDone
+
+	stop()
+	if status, ok := interrupted.exitStatus(); ok {
+		// input may be blocked on a read, it is not waited for
+		return status
+	}
+	if halter.haltedOnSuccess() {
+		// as GNU parallel, failures before enough jobs succeeded do not matter
+		status = 0
+	}
+	if err := <-inputErr; err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurred: %s\n", err)
+		status = max(status, 1)
+	}
+	return status
+}
+
+// recordDelimiter returns the byte terminating input records in pipe mode, which is new line unless a delimiter is given
+func recordDelimiter(flags *xargsFlags) byte {
+	if len(flags.delimiter) != 0 {
+		return flags.delimiter[0]
+	}
+	return '\n'
 }
 
 // Pass argument read from stdin as a single argument to program by sending to argument channel (argch)
 // i.e let cmd to command to be run, then argument channel will be arranged so that command is run like cmd <stdin_arg_1>, cmd <stdin_arg_2>
 // args contains command and its command line flags/arguments
-func passBySingle(scanner *bufio.Scanner, args []string, argch chan<- []string, exitch <-chan struct{}, replacement string) {
+// if tokens is not nil, argument replaces the tokens in args instead of being appended, see tokenExpander.expandArg
+// maxChars limits the length of the command line, zero means no limit
+func passBySingle(scanner argScanner, args []string, argch chan<- *xargsJob, exitch <-chan struct{}, tokens *tokenExpander, maxChars int) error {
+	seq := 0
 	for scanner.Scan() {
 		select {
 		case <-exitch:
-			return
+			return nil
 		default:
+			seq++
 			line := scanner.Text()
-			c := make([]string, len(args))
-			copy(c, args)
-			if len(replacement) == 0 {
-				c = append(c, line)
-				argch <- c
-				continue
+			job := &xargsJob{seq: seq, input: []string{line}}
+			if tokens == nil {
+				job.args = append(slices.Clone(args), line)
+			} else {
+				job.args = tokens.expandArgs(args, job)
+				if tokens.usesSlot(args) {
+					// the slot is not known until the job is started, see jobRunner.runJob
+					job.template = args
+				}
 			}
 
-			// use replacement
-			for i := 0; i < len(args); i++ {
-				if strings.Contains(c[i], replacement) {
-					c[i] = strings.ReplaceAll(c[i], replacement, line)
-				}
+			if maxChars != 0 && commandLineLength(job.args) > maxChars {
+				return errArgLineTooLong
 			}
-			argch <- c
+			argch <- job
 		}
 	}
-	close(argch)
+	return scanner.Err()
 }
 
 // Pass argument read from stdin as multiple arguments (maxArgs) to program by sending to argument channel (argch)
 // i.e let cmd to command to be run, then argument channel will be arranged so that command is run like cmd <stdin_arg_1> <stdin_arg_2> ... <stdin_arg_maxArgs>
 // args contains command and its command line flags/arguments
-func passByMultiple(scanner *bufio.Scanner, args []string, argch chan<- []string, exitch <-chan struct{}, maxArgs int) {
+// maxChars limits the length of the command line, so a command may be run with less than maxArgs arguments, zero means no limit
+func passByMultiple(scanner argScanner, args []string, argch chan<- *xargsJob, exitch <-chan struct{}, maxArgs int, maxChars int) error {
+	seq := 0
 	passArgs := make([]string, 0, maxArgs)
+	commandLength := commandLineLength(args)
+	length := commandLength
+
+	pass := func() {
+		seq++
+		c := make([]string, len(args), len(args)+len(passArgs))
+		copy(c, args)
+		c = append(c, passArgs...)
+		argch <- &xargsJob{seq: seq, args: c, input: c[len(args):]}
+		passArgs = passArgs[:0]
+		length = commandLength
+	}
+
 	for scanner.Scan() {
 		select {
 		case <-exitch:
-			return
+			return nil
 		default:
 			line := scanner.Text()
+			argLength := len(line) + 1
+			if maxChars != 0 && length+argLength > maxChars && len(passArgs) != 0 {
+				pass()
+			}
+			if maxChars != 0 && length+argLength > maxChars {
+				return errArgLineTooLong
+			}
+
 			passArgs = append(passArgs, line)
+			length += argLength
 
 			if len(passArgs) == maxArgs {
-				c := make([]string, len(args), len(args)+maxArgs)
-				copy(c, args)
-				c = append(c, passArgs...)
-				argch <- c
-				passArgs = passArgs[:0]
+				pass()
 			}
 		}
 	}
 
 	if len(passArgs) != 0 {
-		c := make([]string, len(args), len(args)+len(passArgs))
-		copy(c, args)
-		c = append(c, passArgs...)
-		argch <- c
+		pass()
 	}
-
-	close(argch)
+	return scanner.Err()
 }
 
-func splitByZero(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF || len(data) == 0 {
-		return 0, nil, nil
-	}
-	if i := bytes.IndexByte(data, '\u0000'); i >= 0 {
-		return i + 1, data[0:i], nil
+// Pass arguments read from at most maxLines non-blank input lines to program by sending to argument channel (argch)
+// i.e let cmd to command to be run and maxLines be 2, then command is run like cmd <line_1_arg_1> <line_1_arg_2> <line_2_arg_1>
+// args contains command and its command line flags/arguments
+// maxChars limits the length of the command line, a command line including maxLines lines must fit in it
+func passByLines(scanner lineArgScanner, args []string, argch chan<- *xargsJob, exitch <-chan struct{}, maxLines int, maxChars int) error {
+	seq := 0
+	lines := 0
+	c := make([]string, len(args))
+	copy(c, args)
+
+	for scanner.Scan() {
+		select {
+		case <-exitch:
+			return nil
+		default:
+			c = append(c, scanner.Text())
+			if maxChars != 0 && commandLineLength(c) > maxChars {
+				return errArgLineTooLong
+			}
+
+			if !scanner.endOfLine() {
+				continue
+			}
+
+			lines++
+			if lines == maxLines {
+				seq++
+				argch <- &xargsJob{seq: seq, args: c, input: c[len(args):]}
+				c = make([]string, len(args))
+				copy(c, args)
+				lines = 0
+			}
+		}
 	}
-	// eof, return all
-	if atEOF {
-		return len(data), data, nil
+
+	if len(c) != len(args) {
+		seq++
+		argch <- &xargsJob{seq: seq, args: c, input: c[len(args):]}
 	}
-	// Request more data.
-	return 0, nil, nil
+	return scanner.Err()
 }
@@ -0,0 +1,144 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var errInvalidHalt = errors.New("invalid halt policy, it must be never or now|soon,fail|success=N[%] e.g. now,fail=1 or soon,fail=10%")
+
+// haltWhen tells what is done when a halt policy is met
+type haltWhen int
+
+const (
+	haltNever haltWhen = iota
+	// stop starting new jobs, but wait for running ones
+	haltSoon
+	// stop starting new jobs and kill running ones
+	haltNow
+)
+
+// haltPolicy tells when xargs halts as --halt of GNU parallel
+type haltPolicy struct {
+	when haltWhen
+	// halt on successful jobs instead of failed ones
+	success bool
+	// number or percentage of jobs to halt at
+	count   int
+	percent bool
+}
+
+// percentages are evaluated after at least this many jobs finished, so that the first job alone does not halt
+const minHaltPercentJobs = 3
+
+// parseHaltPolicy parses policies like never, now,fail=1, soon,fail=10% or now,success=1
+func parseHaltPolicy(s string) (haltPolicy, error) {
+	if s == "never" {
+		return haltPolicy{}, nil
+	}
+
+	when, condition, found := strings.Cut(s, ",")
+	if !found {
+		return haltPolicy{}, errInvalidHalt
+	}
+
+	var policy haltPolicy
+	switch when {
+	case "soon":
+		policy.when = haltSoon
+	case "now":
+		policy.when = haltNow
+	default:
+		return haltPolicy{}, errInvalidHalt
+	}
+
+	kind, value, found := strings.Cut(condition, "=")
+	if !found {
+		return haltPolicy{}, errInvalidHalt
+	}
+
+	switch kind {
+	case "fail":
+	case "success":
+		policy.success = true
+	default:
+		return haltPolicy{}, errInvalidHalt
+	}
+
+	value, policy.percent = strings.CutSuffix(value, "%")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || policy.percent && n > 100 {
+		return haltPolicy{}, errInvalidHalt
+	}
+	policy.count = n
+
+	return policy, nil
+}
+
+// halter counts finished jobs and halts xargs when its policy is met.
+// Halting stops starting new jobs, and in haltNow mode, kills running ones.
+type halter struct {
+	mu        sync.Mutex
+	policy    haltPolicy
+	finished  int
+	failed    int
+	succeeded int
+	halted    bool
+
+	stop func()
+	kill func()
+}
+
+func newHalter(policy haltPolicy, stop func(), kill func()) *halter {
+	return &halter{policy: policy, stop: stop, kill: kill}
+}
+
+// record counts a finished job and halts if the policy is met
+func (h *halter) record(failed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.policy.when == haltNever || h.halted {
+		return
+	}
+
+	h.finished++
+	var n int
+	if failed {
+		h.failed++
+		n = h.failed
+	} else {
+		h.succeeded++
+		n = h.succeeded
+	}
+
+	if failed == h.policy.success {
+		return
+	}
+
+	if h.policy.percent {
+		if h.finished < minHaltPercentJobs || n*100 < h.policy.count*h.finished {
+			return
+		}
+	} else if n < h.policy.count {
+		return
+	}
+
+	h.halted = true
+	h.stop()
+	if h.policy.when == haltNow {
+		h.kill()
+	}
+}
+
+// haltedOnSuccess reports whether xargs halted since enough jobs succeeded, in which case it exits successfully
+func (h *halter) haltedOnSuccess() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.halted && h.policy.success
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseHaltPolicy(t *testing.T) {
+	cases := []struct {
+		input string
+		want  haltPolicy
+		err   error
+	}{
+		{"never", haltPolicy{}, nil},
+		{"now,fail=1", haltPolicy{when: haltNow, count: 1}, nil},
+		{"soon,fail=30%", haltPolicy{when: haltSoon, count: 30, percent: true}, nil},
+		{"now,success=2", haltPolicy{when: haltNow, success: true, count: 2}, nil},
+		{"now", haltPolicy{}, errInvalidHalt},
+		{"later,fail=1", haltPolicy{}, errInvalidHalt},
+		{"soon,done=1", haltPolicy{}, errInvalidHalt},
+		{"soon,fail=0", haltPolicy{}, errInvalidHalt},
+		{"soon,fail=101%", haltPolicy{}, errInvalidHalt},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			got, err := parseHaltPolicy(c.input)
+			if !errors.Is(err, c.err) {
+				t.Errorf("got %v want %v", err, c.err)
+			}
+			if got != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestHalterRecord(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   haltPolicy
+		failures []bool
+		// number of jobs recorded when halted, zero if never halted
+		haltAt int
+	}{
+		{"never halts", haltPolicy{}, []bool{true, true}, 0},
+		{"halts at second failure", haltPolicy{when: haltSoon, count: 2}, []bool{true, false, true, true}, 3},
+		{"halts at first success", haltPolicy{when: haltNow, success: true, count: 1}, []bool{true, true, false}, 3},
+		{"halts when failure percentage is reached", haltPolicy{when: haltSoon, count: 50, percent: true}, []bool{true, false, false, true}, 4},
+		{"percentage is not evaluated for too few jobs", haltPolicy{when: haltSoon, count: 10, percent: true}, []bool{true, false}, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stopped, killed := 0, 0
+			h := newHalter(c.policy, func() { stopped++ }, func() { killed++ })
+
+			got := 0
+			for i, failed := range c.failures {
+				h.record(failed)
+				if stopped != 0 && got == 0 {
+					got = i + 1
+				}
+			}
+
+			if got != c.haltAt {
+				t.Errorf("got %v want %v", got, c.haltAt)
+			}
+			if stopped > 1 {
+				t.Errorf("got %v stops want 1", stopped)
+			}
+			if (killed != 0) != (got != 0 && c.policy.when == haltNow) {
+				t.Errorf("got killed %v times for %v", killed, c.policy)
+			}
+		})
+	}
+}
+
+func TestProcessHaltNow(t *testing.T) {
+	argFile := filepath.Join(t.TempDir(), "args.txt")
+	os.WriteFile(argFile, []byte("sleep 10\nexit 3\n"), 0644)
+
+	flags := newXargsFlags()
+	flags.argFile = argFile
+	flags.delimiter = "\n"
+	flags.maxProcs = 2
+	flags.halt = haltPolicy{when: haltNow, count: 1}
+
+	start := time.Now()
+	got := process([]string{"sh", "-c"}, flags)
+	if got != exitStatusFailed {
+		t.Errorf("got %v want %v", got, exitStatusFailed)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("running job is not killed, took %s", elapsed)
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	errUnmatchedQuote   = errors.New("unmatched quote; by default quotes are special to xargs unless you use the -0 or -d option")
+	errInvalidDelimiter = errors.New("invalid delimiter, it must be a single character or an escape sequence like \\n, \\t, \\0, \\x41, \\101")
+)
+
+// argScanner reads arguments from input one by one, it is satisfied by *bufio.Scanner
+type argScanner interface {
+	Scan() bool
+	Text() string
+	Err() error
+}
+
+// lineArgScanner is an argScanner which also tells whether the last argument ends a (logical) input line
+type lineArgScanner interface {
+	argScanner
+	endOfLine() bool
+}
+
+// newArgScanner returns a scanner splitting input into arguments according to the flags
+// i.e. by a delimiter for -0 and -d, by lines for -I, --tokens and --colsep, since tokens and columns
+// are values of whole lines, and by blanks honoring quotes and backslashes otherwise
+func newArgScanner(r io.Reader, flags *xargsFlags) lineArgScanner {
+	if len(flags.delimiter) != 0 {
+		scanner := bufio.NewScanner(r)
+		scanner.Split(splitByDelimiter(flags.delimiter[0]))
+		// every item is considered to be on its own line
+		return &delimitedArgScanner{scanner}
+	}
+
+	return &posixArgScanner{r: bufio.NewReader(r), eof: flags.eofString, lines: len(flags.replacement) != 0 || flags.tokens || len(flags.colsep) != 0}
+}
+
+// countingArgScanner counts the arguments scanned
+type countingArgScanner struct {
+	lineArgScanner
+	count int
+}
+
+func (c *countingArgScanner) Scan() bool {
+	if !c.lineArgScanner.Scan() {
+		return false
+	}
+	c.count++
+	return true
+}
+
+// delimitedArgScanner is a lineArgScanner for delimited input, where each item is a line by itself
+type delimitedArgScanner struct {
+	*bufio.Scanner
+}
+
+func (d *delimitedArgScanner) endOfLine() bool {
+	return true
+}
+
+// posixArgScanner splits input into arguments as POSIX xargs does. Arguments are separated by blanks
+// (spaces, tabs and new lines), they can be quoted with single or double quotes and any character
+// can be escaped with a backslash. Quotes cannot span multiple lines.
+type posixArgScanner struct {
+	r *bufio.Reader
+	// input ends at an argument equal to this (-E), empty means no such argument
+	eof string
+	// when set, only new lines separate arguments, blanks do not (-I)
+	lines bool
+
+	token   string
+	lineEnd bool
+	err     error
+	done    bool
+}
+
+func (p *posixArgScanner) Scan() bool {
+	if p.done {
+		return false
+	}
+
+	var token bytes.Buffer
+	inToken := false
+	var quote byte
+	for {
+		c, err := p.r.ReadByte()
+		if err != nil {
+			p.done = true
+			if err != io.EOF {
+				p.err = err
+				return false
+			}
+			if quote != 0 {
+				p.err = errUnmatchedQuote
+				return false
+			}
+			if !inToken {
+				return false
+			}
+			return p.found(p.trim(token.String()), true)
+		}
+
+		switch {
+		case quote != 0:
+			if c == '\n' {
+				p.done = true
+				p.err = errUnmatchedQuote
+				return false
+			}
+			if c == quote {
+				quote = 0
+				continue
+			}
+			token.WriteByte(c)
+		case c == '\\':
+			escaped, err := p.r.ReadByte()
+			if err != nil {
+				// nothing to escape, keep the backslash itself
+				escaped = c
+			}
+			token.WriteByte(escaped)
+			inToken = true
+		case c == '\'' || c == '"':
+			quote = c
+			inToken = true
+		case c == '\n':
+			if inToken {
+				return p.found(p.trim(token.String()), true)
+			}
+		case c == ' ' || c == '\t':
+			if p.lines {
+				if inToken {
+					token.WriteByte(c)
+				}
+				continue
+			}
+			if inToken {
+				return p.found(token.String(), p.onlyBlanksUntilNextToken())
+			}
+		default:
+			token.WriteByte(c)
+			inToken = true
+		}
+	}
+}
+
+// trim removes trailing blanks of a line in line mode, as leading ones are already skipped
+func (p *posixArgScanner) trim(token string) string {
+	if p.lines {
+		return strings.TrimRight(token, " \t")
+	}
+	return token
+}
+
+// onlyBlanksUntilNextToken consumes blanks following an argument and reports whether the argument ends the line.
+// An argument followed by blanks and then a new line does not end the line, since trailing blanks
+// continue a line logically on the next one.
+func (p *posixArgScanner) onlyBlanksUntilNextToken() bool {
+	for {
+		c, err := p.r.ReadByte()
+		if err != nil {
+			return true
+		}
+		if c == ' ' || c == '\t' {
+			continue
+		}
+		if c != '\n' {
+			p.r.UnreadByte()
+		}
+		return false
+	}
+}
+
+func (p *posixArgScanner) found(token string, lineEnd bool) bool {
+	if len(p.eof) != 0 && token == p.eof {
+		p.done = true
+		return false
+	}
+
+	p.token = token
+	p.lineEnd = lineEnd
+	return true
+}
+
+func (p *posixArgScanner) Text() string {
+	return p.token
+}
+
+func (p *posixArgScanner) Err() error {
+	return p.err
+}
+
+func (p *posixArgScanner) endOfLine() bool {
+	return p.lineEnd
+}
+
+// splitByDelimiter returns a split function for bufio.Scanner, which splits input by delimiter.
+// Input does not have to end with the delimiter.
+func splitByDelimiter(delimiter byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.IndexByte(data, delimiter); i >= 0 {
+			return i + 1, data[0:i], nil
+		}
+		// eof, return all
+		if atEOF {
+			return len(data), data, nil
+		}
+		// Request more data.
+		return 0, nil, nil
+	}
+}
+
+// parseDelimiter parses the argument of -d, which is either a single character or
+// an escape sequence as in C (\n, \t, \0, \\ ...), hexadecimal (\x0A) or octal (\012)
+func parseDelimiter(s string) (string, error) {
+	if len(s) == 1 {
+		return s, nil
+	}
+
+	if len(s) < 2 || s[0] != '\\' {
+		return "", errInvalidDelimiter
+	}
+
+	if len(s) == 2 {
+		escapes := map[byte]byte{'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v', '\\': '\\', '0': 0}
+		c, ok := escapes[s[1]]
+		if !ok {
+			return "", errInvalidDelimiter
+		}
+		return string([]byte{c}), nil
+	}
+
+	base, digits := 8, s[1:]
+	if s[1] == 'x' {
+		base, digits = 16, s[2:]
+	}
+
+	n, err := strconv.ParseUint(digits, base, 8)
+	if err != nil {
+		return "", errInvalidDelimiter
+	}
+	return string([]byte{byte(n)}), nil
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPosixArgScanner(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		flags xargsFlags
+		want  []string
+	}{
+		{"blanks and new lines", "a b\tc\n\n  d  \ne", xargsFlags{}, []string{"a", "b", "c", "d", "e"}},
+		{"single quotes", `'a b' c'd e'f`, xargsFlags{}, []string{"a b", "cd ef"}},
+		{"double quotes", `"it's" "" x`, xargsFlags{}, []string{"it's", "", "x"}},
+		{"backslash", `a\ b c\"d \\`, xargsFlags{}, []string{"a b", `c"d`, `\`}},
+		{"eof string", "a b STOP c\nd", xargsFlags{eofString: "STOP"}, []string{"a", "b"}},
+		{"eof string as part of argument", "a xSTOP c", xargsFlags{eofString: "STOP"}, []string{"a", "xSTOP", "c"}},
+		{"lines for replacement", "  file one.txt  \nfile 'two'.txt\n\n", xargsFlags{replacement: "{}"}, []string{"file one.txt", "file two.txt"}},
+		{"lines for tokens", "a b.txt\nc\n", xargsFlags{tokens: true}, []string{"a b.txt", "c"}},
+		{"lines for column separator", "a\tb\n", xargsFlags{colsep: `\t`}, []string{"a\tb"}},
+		{"zero delimited", "a b\u0000c\nd\u0000e", xargsFlags{delimiter: zeroDelimiter}, []string{"a b", "c\nd", "e"}},
+		{"custom delimiter", "a b,'c',,d", xargsFlags{delimiter: ","}, []string{"a b", "'c'", "", "d"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			scanner := newArgScanner(strings.NewReader(c.input), &c.flags)
+			got := make([]string, 0)
+			for scanner.Scan() {
+				got = append(got, scanner.Text())
+			}
+
+			if err := scanner.Err(); err != nil {
+				t.Errorf("Error not expected here %s", err)
+			}
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPosixArgScannerUnmatchedQuote(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{"quote not closed until eof", "a 'b c"},
+		{"quote not closed until end of line", "a \"b\nc\""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			scanner := newArgScanner(strings.NewReader(c.input), &xargsFlags{})
+			for scanner.Scan() {
+			}
+
+			if !errors.Is(scanner.Err(), errUnmatchedQuote) {
+				t.Errorf("got %v want %v", scanner.Err(), errUnmatchedQuote)
+			}
+		})
+	}
+}
+
+func TestPassByLines(t *testing.T) {
+	cases := []struct {
+		name          string
+		inputStdin    string
+		inputMaxLines int
+		want          [][]string
+	}{
+		{
+			"one line per command",
+			"a b\nc\n\nd e f",
+			1,
+			[][]string{{"echo", "a", "b"}, {"echo", "c"}, {"echo", "d", "e", "f"}},
+		},
+		{
+			"two lines per command",
+			"a b\nc\nd e f",
+			2,
+			[][]string{{"echo", "a", "b", "c"}, {"echo", "d", "e", "f"}},
+		},
+		{
+			"trailing blank continues line",
+			"a b \nc\nd",
+			1,
+			[][]string{{"echo", "a", "b", "c"}, {"echo", "d"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			scanner := newArgScanner(strings.NewReader(c.inputStdin), &xargsFlags{})
+			ch := make(chan *xargsJob, len(c.want))
+			err := passByLines(scanner, []string{"echo"}, ch, nil, c.inputMaxLines, 0)
+			close(ch)
+			if err != nil {
+				t.Errorf("Error not expected here %s", err)
+			}
+
+			got := make([][]string, 0, len(c.want))
+			for v := range ch {
+				got = append(got, v.args)
+			}
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"single character", ",", ","},
+		{"new line escape", `\n`, "\n"},
+		{"tab escape", `\t`, "\t"},
+		{"nul escape", `\0`, "\u0000"},
+		{"backslash escape", `\\`, `\`},
+		{"hexadecimal", `\x41`, "A"},
+		{"octal", `\101`, "A"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseDelimiter(c.input)
+			if err != nil {
+				t.Errorf("Error not expected here %s", err)
+			}
+
+			if got != c.want {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+
+	for _, input := range []string{"", "ab", `\q`, `\x`, `\777`} {
+		if _, err := parseDelimiter(input); !errors.Is(err, errInvalidDelimiter) {
+			t.Errorf("input %q got %v want %v", input, err, errInvalidDelimiter)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// header of the job log, columns are the same as GNU parallel's, so that logs are interchangeable
+const jobLogHeader = "Seq\tHost\tStarttime\tJobRuntime\tSend\tReceive\tExitval\tSignal\tCommand\n"
+
+// jobs always run on the local host, which GNU parallel logs as ':'
+const jobLogLocalHost = ":"
+
+// jobLog writes a tab separated line for each finished job
+type jobLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// openJobLog opens the job log file. It is truncated unless resume is set,
+// in which case new entries are appended to the existing ones.
+func openJobLog(path string, resume bool) (*os.File, *jobLog, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	if info.Size() == 0 {
+		if _, err := io.WriteString(f, jobLogHeader); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	}
+
+	return f, &jobLog{w: f}, nil
+}
+
+func (j *jobLog) write(job *xargsJob, result jobResult) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	starttime := float64(result.start.UnixMilli()) / 1000
+	_, err := fmt.Fprintf(j.w, "%d\t%s\t%.3f\t%10.3f\t%d\t%d\t%d\t%d\t%s\n",
+		job.seq, jobLogLocalHost, starttime, result.runtime.Seconds(), 0, 0, result.exitCode, int(result.signal), shellQuote(job.args))
+	return err
+}
+
+// resumeMode tells which jobs of a previous run are skipped
+type resumeMode int
+
+const (
+	// run all jobs
+	resumeNone resumeMode = iota
+	// skip jobs in the job log
+	resumeAll
+	// skip jobs that succeeded according to the job log, so that failed jobs are run again
+	resumeFailed
+)
+
+// readJobLog reads the job log of a previous run, and returns the sequence numbers of jobs to skip
+func readJobLog(r io.Reader, mode resumeMode) (map[int]bool, error) {
+	skip := make(map[int]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 || strings.HasPrefix(line, "Seq\t") {
+			continue
+		}
+
+		cols := strings.Split(line, "\t")
+		if len(cols) < 9 {
+			return nil, fmt.Errorf("invalid job log line: %s", line)
+		}
+
+		seq, err := strconv.Atoi(cols[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence in job log line: %s", line)
+		}
+
+		exitval, err := strconv.Atoi(cols[6])
+		if err != nil {
+			return nil, fmt.Errorf("invalid exit value in job log line: %s", line)
+		}
+
+		signal, err := strconv.Atoi(cols[7])
+		if err != nil {
+			return nil, fmt.Errorf("invalid signal in job log line: %s", line)
+		}
+
+		succeeded := exitval == 0 && signal == 0
+		switch mode {
+		case resumeAll:
+			skip[seq] = true
+		case resumeFailed:
+			// a job may be logged multiple times, when it is retried on a resumed run
+			skip[seq] = skip[seq] || succeeded
+		}
+	}
+
+	return skip, scanner.Err()
+}
+
+// readJobLogFile is readJobLog for a file, a missing file means there is nothing to skip
+func readJobLogFile(path string, mode resumeMode) (map[int]bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return map[int]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readJobLog(f, mode)
+}
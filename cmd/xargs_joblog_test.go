@@ -0,0 +1,96 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJobLogWrite(t *testing.T) {
+	var out bytes.Buffer
+	log := &jobLog{w: &out}
+
+	job := &xargsJob{seq: 3, args: []string{"echo", "a b"}}
+	result := jobResult{exitCode: -1, signal: syscall.SIGKILL, start: time.UnixMilli(1700000000123), runtime: 1500 * time.Millisecond}
+	if err := log.write(job, result); err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+
+	want := "3\t:\t1700000000.123\t     1.500\t0\t0\t-1\t9\techo 'a b'\n"
+	if out.String() != want {
+		t.Errorf("got %q want %q", out.String(), want)
+	}
+}
+
+func TestReadJobLog(t *testing.T) {
+	log := jobLogHeader +
+		"1\t:\t1700000000.000\t     0.010\t0\t0\t0\t0\techo a\n" +
+		"2\t:\t1700000000.000\t     0.010\t0\t0\t1\t0\techo b\n" +
+		"3\t:\t1700000000.000\t     0.010\t0\t0\t-1\t9\techo c\n" +
+		"2\t:\t1700000001.000\t     0.010\t0\t0\t0\t0\techo b\n"
+
+	cases := []struct {
+		name string
+		mode resumeMode
+		want map[int]bool
+	}{
+		{"resume skips all logged jobs", resumeAll, map[int]bool{1: true, 2: true, 3: true}},
+		{"resume failed skips succeeded jobs", resumeFailed, map[int]bool{1: true, 2: true, 3: false}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := readJobLog(strings.NewReader(log), c.mode)
+			if err != nil {
+				t.Fatalf("Error not expected here %s", err)
+			}
+
+			for seq, want := range c.want {
+				if got[seq] != want {
+					t.Errorf("job %d got %v want %v", seq, got[seq], want)
+				}
+			}
+		})
+	}
+
+	if _, err := readJobLog(strings.NewReader("1\t:\t0\n"), resumeAll); err == nil {
+		t.Errorf("Error expected here")
+	}
+}
+
+func TestOpenJobLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.log")
+
+	skip, err := readJobLogFile(path, resumeAll)
+	if err != nil || len(skip) != 0 {
+		t.Errorf("got %v %v want empty skip set for missing job log", skip, err)
+	}
+
+	for _, resume := range []bool{false, true} {
+		f, log, err := openJobLog(path, resume)
+		if err != nil {
+			t.Fatalf("Error not expected here %s", err)
+		}
+		log.write(&xargsJob{seq: 1, args: []string{"true"}}, jobResult{start: time.Now()})
+		f.Close()
+	}
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 || lines[0]+"\n" != jobLogHeader {
+		t.Errorf("got %q want header and two entries", data)
+	}
+
+	skip, err = readJobLogFile(path, resumeAll)
+	if err != nil || !reflect.DeepEqual(skip, map[int]bool{1: true}) {
+		t.Errorf("got %v %v want %v", skip, err, map[int]bool{1: true})
+	}
+}
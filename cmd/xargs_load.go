@@ -0,0 +1,90 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// how often load and free memory are checked again while a job is delayed
+const resourceCheckInterval = time.Second
+
+// resourceGate delays starting jobs while the system is busy, that is while the load average is
+// above maxLoad or the available memory is below minMemFree. Zero values disable the checks.
+type resourceGate struct {
+	mu         sync.Mutex
+	maxLoad    float64
+	minMemFree uint64
+	interval   time.Duration
+
+	readLoad         func() (float64, error)
+	readMemAvailable func() (uint64, error)
+	// errors reading procfs are reported once here, jobs are not delayed then
+	warn     io.Writer
+	warnOnce sync.Once
+}
+
+func newResourceGate(maxLoad float64, minMemFree uint64, warn io.Writer) *resourceGate {
+	return &resourceGate{
+		maxLoad: maxLoad, minMemFree: minMemFree, interval: resourceCheckInterval,
+		readLoad: readLoadAverage, readMemAvailable: readMemAvailable, warn: warn,
+	}
+}
+
+// wait blocks until a job can be started or stopch is closed. Waiting jobs are let in one by one,
+// so that they are not all started at once as soon as the system is not busy.
+func (g *resourceGate) wait(stopch <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for g.busy() {
+		select {
+		case <-stopch:
+			return
+		case <-time.After(g.interval):
+		}
+	}
+}
+
+func (g *resourceGate) busy() bool {
+	if g.maxLoad != 0 {
+		load, err := g.readLoad()
+		if err != nil {
+			g.warnf("cannot read load average, not limiting by load %s\n", err)
+		} else if load > g.maxLoad {
+			return true
+		}
+	}
+
+	if g.minMemFree != 0 {
+		available, err := g.readMemAvailable()
+		if err != nil {
+			g.warnf("cannot read available memory, not limiting by memory %s\n", err)
+		} else if available < g.minMemFree {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *resourceGate) warnf(format string, args ...any) {
+	g.warnOnce.Do(func() {
+		fmt.Fprintf(g.warn, format, args...)
+	})
+}
+
+// parseMemFree parses the argument of --memfree, a size like 512M or 2GiB
+func parseMemFree(s string) (uint64, error) {
+	size, err := humanize.ParseBytes(s)
+	if err != nil || size == 0 {
+		return 0, errInvalidArgument
+	}
+	return size, nil
+}
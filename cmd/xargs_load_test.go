@@ -0,0 +1,67 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResourceGateWait(t *testing.T) {
+	loads := []float64{4, 3, 1}
+	memory := []uint64{100, 300}
+
+	var warnings bytes.Buffer
+	g := newResourceGate(2, 200, &warnings)
+	g.interval = time.Millisecond
+	loadReads, memReads := 0, 0
+	g.readLoad = func() (float64, error) {
+		load := loads[min(loadReads, len(loads)-1)]
+		loadReads++
+		return load, nil
+	}
+	g.readMemAvailable = func() (uint64, error) {
+		available := memory[min(memReads, len(memory)-1)]
+		memReads++
+		return available, nil
+	}
+
+	g.wait(nil)
+
+	// load is checked until it drops, then memory until there is enough
+	if loadReads != 4 || memReads != 2 {
+		t.Errorf("got %v load and %v memory reads want %v and %v", loadReads, memReads, 4, 2)
+	}
+
+	if warnings.Len() != 0 {
+		t.Errorf("got %q want no warnings", warnings.String())
+	}
+}
+
+func TestResourceGateStop(t *testing.T) {
+	g := newResourceGate(1, 0, &bytes.Buffer{})
+	g.interval = time.Millisecond
+	g.readLoad = func() (float64, error) { return 10, nil }
+
+	stopch := make(chan struct{})
+	close(stopch)
+	// must return although the system stays busy
+	g.wait(stopch)
+}
+
+func TestResourceGateReadError(t *testing.T) {
+	var warnings bytes.Buffer
+	g := newResourceGate(1, 0, &warnings)
+	g.readLoad = func() (float64, error) { return 0, errors.New("no procfs") }
+
+	g.wait(nil)
+	g.wait(nil)
+
+	if strings.Count(warnings.String(), "no procfs") != 1 {
+		t.Errorf("got %q want a single warning", warnings.String())
+	}
+}
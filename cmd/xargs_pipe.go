@@ -0,0 +1,53 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"slices"
+)
+
+// size of the blocks input is split into in pipe mode unless --block is given, as GNU parallel does
+const defaultBlockSize = 1024 * 1024
+
+// Pass input in blocks to stdin of the program by sending to argument channel (argch)
+// i.e let cmd to command to be run, then it is run once for each block of input, reading the block from its stdin.
+// A block is blockSize bytes extended to the end of the record it ends in, so that records are never split
+// between commands. Records are terminated by the delimiter.
+// args contains command and its command line flags/arguments
+func passByBlocks(r io.Reader, args []string, argch chan<- *xargsJob, exitch <-chan struct{}, blockSize int, delimiter byte) error {
+	reader := bufio.NewReader(r)
+	seq := 0
+	for {
+		block := make([]byte, blockSize)
+		n, err := io.ReadFull(reader, block)
+		block = block[:n]
+		if err == nil && block[n-1] != delimiter {
+			// complete the last record
+			var rest []byte
+			rest, err = reader.ReadBytes(delimiter)
+			block = append(block, rest...)
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		if len(block) != 0 {
+			select {
+			case <-exitch:
+				return nil
+			default:
+				seq++
+				argch <- &xargsJob{seq: seq, args: slices.Clone(args), block: block}
+			}
+		}
+
+		if err != nil {
+			return nil
+		}
+	}
+}
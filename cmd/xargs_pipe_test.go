@@ -0,0 +1,49 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPassByBlocks(t *testing.T) {
+	cases := []struct {
+		name      string
+		input     string
+		blockSize int
+		delimiter byte
+		want      []string
+	}{
+		{"records are not split", "aa\nbbbb\ncc\nd", 3, '\n', []string{"aa\n", "bbbb\n", "cc\n", "d"}},
+		{"block ends at record boundary", "ab\ncd\n", 3, '\n', []string{"ab\n", "cd\n"}},
+		{"nul delimited records", "a b\x00c\x00", 2, 0, []string{"a b\x00", "c\x00"}},
+		{"block larger than input", "a\nb\n", 100, '\n', []string{"a\nb\n"}},
+		{"empty input", "", 10, '\n', []string{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ch := make(chan *xargsJob, 10)
+			err := passByBlocks(strings.NewReader(c.input), []string{"wc", "-l"}, ch, nil, c.blockSize, c.delimiter)
+			close(ch)
+			if err != nil {
+				t.Errorf("Error not expected here %s", err)
+			}
+
+			got := make([]string, 0)
+			for job := range ch {
+				if !reflect.DeepEqual(job.args, []string{"wc", "-l"}) {
+					t.Errorf("got %v want %v", job.args, []string{"wc", "-l"})
+				}
+				got = append(got, string(job.block))
+			}
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how often progress is reported, it is rewritten in place on a terminal, otherwise a line is logged each time
+const (
+	progressTerminalInterval = 500 * time.Millisecond
+	progressLogInterval      = 10 * time.Second
+)
+
+// progress counts jobs and reports them on stderr for --progress and --eta
+type progress struct {
+	mu        sync.Mutex
+	running   int
+	completed int
+	failed    int
+	skipped   int
+	runtime   time.Duration
+	// number of jobs in input, -1 until whole input is read
+	total int
+	start time.Time
+
+	eta      bool
+	out      io.Writer
+	terminal bool
+	now      func() time.Time
+}
+
+func newProgress(eta bool, out *os.File) *progress {
+	terminal := false
+	if info, err := out.Stat(); err == nil {
+		terminal = info.Mode()&os.ModeCharDevice != 0
+	}
+	return &progress{total: -1, start: time.Now(), eta: eta, out: out, terminal: terminal, now: time.Now}
+}
+
+// jobStarted, jobFinished and jobSkipped do nothing for a nil progress, so that they can be called unconditionally
+func (p *progress) jobStarted() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running++
+}
+
+func (p *progress) jobFinished(runtime time.Duration, failed bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+	p.completed++
+	p.runtime += runtime
+	if failed {
+		p.failed++
+	}
+}
+
+// jobSkipped counts a job which is not run e.g. since it is resumed or xargs is stopping
+func (p *progress) jobSkipped() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.skipped++
+}
+
+func (p *progress) inputDone(total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+}
+
+// countJobs forwards jobs from argch to the returned channel, so that the total number of jobs is known when input ends
+func (p *progress) countJobs(argch <-chan *xargsJob) <-chan *xargsJob {
+	counted := make(chan *xargsJob)
+	go func() {
+		n := 0
+		for job := range argch {
+			n++
+			counted <- job
+		}
+		p.inputDone(n)
+		close(counted)
+	}()
+	return counted
+}
+
+// String renders the progress e.g. "xargs: 10/25 completed, 4 running, 1 failed, avg 1.2s, ETA 5s"
+func (p *progress) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("xargs: ")
+	if p.total >= 0 {
+		fmt.Fprintf(&b, "%d/%d", p.completed, p.total-p.skipped)
+	} else {
+		fmt.Fprintf(&b, "%d", p.completed)
+	}
+	fmt.Fprintf(&b, " completed, %d running, %d failed", p.running, p.failed)
+
+	if p.completed != 0 {
+		fmt.Fprintf(&b, ", avg %s", roundDuration(p.runtime/time.Duration(p.completed)))
+	}
+
+	if p.eta {
+		b.WriteString(", ETA ")
+		b.WriteString(p.estimate())
+	}
+	return b.String()
+}
+
+// estimate returns the remaining time by the rate jobs are completed so far, so that parallelism is accounted for
+func (p *progress) estimate() string {
+	if p.total < 0 || p.completed == 0 {
+		return "?"
+	}
+
+	remaining := p.total - p.skipped - p.completed
+	elapsed := p.now().Sub(p.start)
+	return roundDuration(elapsed * time.Duration(remaining) / time.Duration(p.completed)).String()
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
+
+// report writes the progress periodically until finished is closed, then writes the final progress
+// and closes done
+func (p *progress) report(finished <-chan struct{}, done chan<- struct{}) {
+	interval := progressLogInterval
+	if p.terminal {
+		interval = progressTerminalInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer close(done)
+	for {
+		select {
+		case <-finished:
+			p.write(true)
+			return
+		case <-ticker.C:
+			p.write(false)
+		}
+	}
+}
+
+func (p *progress) write(final bool) {
+	if !p.terminal {
+		fmt.Fprintln(p.out, p)
+		return
+	}
+
+	// rewrite the line in place, clearing the rest of the previous one
+	fmt.Fprintf(p.out, "\r%s\033[K", p)
+	if final {
+		fmt.Fprintln(p.out)
+	}
+}
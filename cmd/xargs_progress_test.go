@@ -0,0 +1,86 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressString(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	p := &progress{total: -1, start: start, eta: true, now: func() time.Time { return start.Add(10 * time.Second) }}
+
+	if got, want := p.String(), "xargs: 0 completed, 0 running, 0 failed, ETA ?"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	for i := 0; i < 4; i++ {
+		p.jobStarted()
+	}
+	p.jobFinished(2*time.Second, false)
+	p.jobFinished(4*time.Second, true)
+	p.jobSkipped()
+
+	if got, want := p.String(), "xargs: 2 completed, 2 running, 1 failed, avg 3s, ETA ?"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	// 2 jobs completed in 10s, so 4 remaining jobs take 20s
+	p.inputDone(7)
+	if got, want := p.String(), "xargs: 2/6 completed, 2 running, 1 failed, avg 3s, ETA 20s"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	p.eta = false
+	if got, want := p.String(), "xargs: 2/6 completed, 2 running, 1 failed, avg 3s"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestProgressCountJobs(t *testing.T) {
+	p := &progress{total: -1}
+	argch := make(chan *xargsJob, 3)
+	for i := 1; i <= 3; i++ {
+		argch <- &xargsJob{seq: i}
+	}
+	close(argch)
+
+	for range p.countJobs(argch) {
+	}
+
+	if p.total != 3 {
+		t.Errorf("got %v want %v", p.total, 3)
+	}
+}
+
+func TestProgressReport(t *testing.T) {
+	cases := []struct {
+		name     string
+		terminal bool
+		want     string
+	}{
+		{"log lines when not a terminal", false, "xargs: 0 completed, 0 running, 0 failed\n"},
+		{"rewritten in place on a terminal", true, "\rxargs: 0 completed, 0 running, 0 failed\033[K\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := &progress{total: -1, out: &out, terminal: c.terminal, now: time.Now}
+
+			finished := make(chan struct{})
+			done := make(chan struct{})
+			close(finished)
+			p.report(finished, done)
+			<-done
+
+			if got := out.String(); !strings.HasSuffix(got, c.want) {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
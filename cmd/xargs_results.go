@@ -0,0 +1,263 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// resultStore saves output and result of each job for --results, so that a run can be audited afterwards
+type resultStore interface {
+	// output returns the writers stdout and stderr of the job are copied to while it runs, they are closed when
+	// the command exits. It is called for every attempt of the job, so that the output of the last one is saved.
+	output(job *xargsJob) (stdout io.WriteCloser, stderr io.WriteCloser, err error)
+	save(job *xargsJob, result jobResult) error
+	Close() error
+}
+
+// at most this many bytes of stdout and of stderr of a job are embedded in CSV and JSON results,
+// so that output is not buffered without a limit, the rest is discarded
+const maxEmbeddedOutput = 1 << 20
+
+// newResultStore returns a store saving results to a CSV or JSON lines file when path ends with .csv or .json,
+// otherwise to a directory, see dirResults
+func newResultStore(path string) (resultStore, error) {
+	switch filepath.Ext(path) {
+	case ".csv":
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		w := csv.NewWriter(f)
+		w.Write([]string{"Seq", "Host", "Starttime", "JobRuntime", "Exitval", "Signal", "Command", "Input", "Stdout", "Stderr"})
+		w.Flush()
+		if err := w.Error(); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &csvResults{capturedOutputs: newCapturedOutputs(), f: f, w: w}, nil
+	case ".json":
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonResults{capturedOutputs: newCapturedOutputs(), f: f, enc: json.NewEncoder(f)}, nil
+	default:
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, err
+		}
+		return &dirResults{root: path}, nil
+	}
+}
+
+// dirResults saves results of a job in a directory named after its input as GNU parallel does, that is
+// root/1/<input>/ with '/' in input escaped as '\_'. Jobs without input (e.g. --pipe) are saved in root/seq/<seq>/.
+// The directory contains stdout, stderr, seq, exitcode (exit code and signal) and timing (start time and runtime).
+// stdout and stderr are written while the job runs.
+type dirResults struct {
+	root string
+}
+
+func (d *dirResults) dir(job *xargsJob) string {
+	if len(job.input) != 0 {
+		return filepath.Join(d.root, "1", escapeResultName(strings.Join(job.input, " ")))
+	}
+	return filepath.Join(d.root, "seq", strconv.Itoa(job.seq))
+}
+
+func (d *dirResults) output(job *xargsJob) (io.WriteCloser, io.WriteCloser, error) {
+	dir := d.dir(job)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		stdout.Close()
+		return nil, nil, err
+	}
+	return &resultFile{f: stdout}, &resultFile{f: stderr}, nil
+}
+
+func (d *dirResults) save(job *xargsJob, result jobResult) error {
+	dir := d.dir(job)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data string
+	}{
+		{"seq", fmt.Sprintf("%d\n", job.seq)},
+		{"exitcode", fmt.Sprintf("%d\t%d\n", result.exitCode, int(result.signal))},
+		{"timing", fmt.Sprintf("%.3f\t%.3f\n", float64(result.start.UnixMilli())/1000, result.runtime.Seconds())},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.name), []byte(f.data), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dirResults) Close() error {
+	return nil
+}
+
+// escapeResultName makes the input usable as a single directory name
+func escapeResultName(input string) string {
+	name := strings.NewReplacer(`\`, `\\`, "/", `\_`).Replace(input)
+	if name == "" || name == "." || name == ".." {
+		name = `\` + name
+	}
+	return name
+}
+
+// resultFile is an output file of a job. Write errors do not fail the command, since its output is
+// also written to stdout of xargs, the first one is reported by Close instead.
+type resultFile struct {
+	f   *os.File
+	err error
+}
+
+func (r *resultFile) Write(p []byte) (int, error) {
+	if r.err == nil {
+		_, r.err = r.f.Write(p)
+	}
+	return len(p), nil
+}
+
+func (r *resultFile) Close() error {
+	err := r.f.Close()
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the rest
+type cappedBuffer struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.max - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func (c *cappedBuffer) Close() error {
+	return nil
+}
+
+// capturedOutputs keeps output of running jobs until their results are saved in a CSV or JSON file
+type capturedOutputs struct {
+	mu   sync.Mutex
+	jobs map[int][2]*cappedBuffer
+}
+
+func newCapturedOutputs() *capturedOutputs {
+	return &capturedOutputs{jobs: make(map[int][2]*cappedBuffer)}
+}
+
+func (c *capturedOutputs) output(job *xargsJob) (io.WriteCloser, io.WriteCloser, error) {
+	stdout, stderr := &cappedBuffer{max: maxEmbeddedOutput}, &cappedBuffer{max: maxEmbeddedOutput}
+	c.mu.Lock()
+	// replaces the output of a previous attempt
+	c.jobs[job.seq] = [2]*cappedBuffer{stdout, stderr}
+	c.mu.Unlock()
+	return stdout, stderr, nil
+}
+
+// take returns the output captured for the job and forgets it
+func (c *capturedOutputs) take(job *xargsJob) (stdout string, stderr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	captured, ok := c.jobs[job.seq]
+	if !ok {
+		return "", ""
+	}
+	delete(c.jobs, job.seq)
+	return captured[0].buf.String(), captured[1].buf.String()
+}
+
+type csvResults struct {
+	*capturedOutputs
+	mu sync.Mutex
+	f  io.WriteCloser
+	w  *csv.Writer
+}
+
+func (c *csvResults) save(job *xargsJob, result jobResult) error {
+	stdout, stderr := c.take(job)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.w.Write([]string{
+		strconv.Itoa(job.seq), jobLogLocalHost,
+		fmt.Sprintf("%.3f", float64(result.start.UnixMilli())/1000), fmt.Sprintf("%.3f", result.runtime.Seconds()),
+		strconv.Itoa(result.exitCode), strconv.Itoa(int(result.signal)),
+		shellQuote(job.args), strings.Join(job.input, " "), stdout, stderr,
+	})
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvResults) Close() error {
+	return c.f.Close()
+}
+
+// jsonResult is a line of the JSON lines results file
+type jsonResult struct {
+	Seq        int      `json:"seq"`
+	Host       string   `json:"host"`
+	Starttime  float64  `json:"starttime"`
+	JobRuntime float64  `json:"jobruntime"`
+	Exitval    int      `json:"exitval"`
+	Signal     int      `json:"signal"`
+	Command    []string `json:"command"`
+	Input      []string `json:"input"`
+	Stdout     string   `json:"stdout"`
+	Stderr     string   `json:"stderr"`
+}
+
+type jsonResults struct {
+	*capturedOutputs
+	mu  sync.Mutex
+	f   io.WriteCloser
+	enc *json.Encoder
+}
+
+func (j *jsonResults) save(job *xargsJob, result jobResult) error {
+	stdout, stderr := j.take(job)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.enc.Encode(jsonResult{
+		Seq: job.seq, Host: jobLogLocalHost,
+		Starttime: float64(result.start.UnixMilli()) / 1000, JobRuntime: result.runtime.Seconds(),
+		Exitval: result.exitCode, Signal: int(result.signal),
+		Command: job.args, Input: job.input, Stdout: stdout, Stderr: stderr,
+	})
+}
+
+func (j *jsonResults) Close() error {
+	return j.f.Close()
+}
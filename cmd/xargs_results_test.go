@@ -0,0 +1,168 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testResultJob = &xargsJob{seq: 2, args: []string{"cat", "dir/a b"}, input: []string{"dir/a b"}}
+
+var testResult = jobResult{exitCode: 1, start: time.UnixMilli(1700000000500), runtime: 250 * time.Millisecond}
+
+// saveTestResult saves testResult with the output a command would write while running
+func saveTestResult(t *testing.T, store resultStore) {
+	stdout, stderr, err := store.output(testResultJob)
+	if err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+	io.WriteString(stdout, "out\n")
+	io.WriteString(stderr, "err\n")
+	stdout.Close()
+	stderr.Close()
+
+	if err := store.save(testResultJob, testResult); err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+}
+
+func TestDirResults(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "results")
+	store, err := newResultStore(root)
+	if err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+	defer store.Close()
+
+	saveTestResult(t, store)
+	if err := store.save(&xargsJob{seq: 3, args: []string{"wc"}}, jobResult{}); err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+
+	want := map[string]string{
+		`1/dir\_a b/stdout`:   "out\n",
+		`1/dir\_a b/stderr`:   "err\n",
+		`1/dir\_a b/seq`:      "2\n",
+		`1/dir\_a b/exitcode`: "1\t0\n",
+		`1/dir\_a b/timing`:   "1700000000.500\t0.250\n",
+		"seq/3/seq":           "3\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Errorf("Error not expected here %s", err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("%s got %q want %q", name, got, content)
+		}
+	}
+}
+
+func TestDirResultsStreamsOutput(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "results")
+	store, _ := newResultStore(root)
+	defer store.Close()
+
+	stdout, stderr, err := store.output(testResultJob)
+	if err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+	defer stdout.Close()
+	defer stderr.Close()
+	io.WriteString(stdout, "partial\n")
+
+	// output is in the file while the job is still running
+	got, _ := os.ReadFile(filepath.Join(root, `1/dir\_a b/stdout`))
+	if string(got) != "partial\n" {
+		t.Errorf("got %q want %q", got, "partial\n")
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	c := &cappedBuffer{max: 5}
+	for _, s := range []string{"abc", "def", "gh"} {
+		if n, err := io.WriteString(c, s); n != len(s) || err != nil {
+			t.Errorf("got %v %v want %v nil", n, err, len(s))
+		}
+	}
+
+	if got := c.buf.String(); got != "abcde" {
+		t.Errorf("got %q want %q", got, "abcde")
+	}
+}
+
+func TestEscapeResultName(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"a b", "a b"},
+		{"/tmp/a", `\_tmp\_a`},
+		{`a\b`, `a\\b`},
+		{"..", `\..`},
+		{"", `\`},
+	}
+
+	for _, c := range cases {
+		if got := escapeResultName(c.input); got != c.want {
+			t.Errorf("got %q want %q", got, c.want)
+		}
+	}
+}
+
+func TestCsvResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	store, err := newResultStore(path)
+	if err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+	saveTestResult(t, store)
+	store.Close()
+
+	f, _ := os.Open(path)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+
+	want := [][]string{
+		{"Seq", "Host", "Starttime", "JobRuntime", "Exitval", "Signal", "Command", "Input", "Stdout", "Stderr"},
+		{"2", ":", "1700000000.500", "0.250", "1", "0", "cat 'dir/a b'", "dir/a b", "out\n", "err\n"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q want %q", records, want)
+	}
+}
+
+func TestJsonResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	store, err := newResultStore(path)
+	if err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+	saveTestResult(t, store)
+	store.Close()
+
+	data, _ := os.ReadFile(path)
+	var got jsonResult
+	if err := json.NewDecoder(strings.NewReader(string(data))).Decode(&got); err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+
+	want := jsonResult{Seq: 2, Host: ":", Starttime: 1700000000.5, JobRuntime: 0.25, Exitval: 1,
+		Command: []string{"cat", "dir/a b"}, Input: []string{"dir/a b"}, Stdout: "out\n", Stderr: "err\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"sync"
+)
+
+// scheduler runs jobs concurrently, at most limit of them at a time.
+// The limit can be changed while jobs are running, e.g. by SIGUSR1 and SIGUSR2 as in GNU xargs.
+type scheduler struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	running int
+	// slots of running jobs, a job gets the lowest free slot starting from 1
+	used map[int]bool
+}
+
+func newScheduler(limit int) *scheduler {
+	s := &scheduler{limit: limit, used: make(map[int]bool)}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// run starts runJob for each job from argch as soon as the number of running jobs is below the limit,
+// it returns after argch is closed and all jobs are finished. When abort is closed, remaining jobs are
+// not started, it returns as soon as running jobs are finished.
+func (s *scheduler) run(argch <-chan *xargsJob, abort <-chan struct{}, runJob func(*xargsJob)) {
+	var wg sync.WaitGroup
+	for {
+		var job *xargsJob
+		var open bool
+		select {
+		case <-abort:
+		case job, open = <-argch:
+		}
+		if !open {
+			break
+		}
+
+		slot := s.acquire()
+		if isStopped(abort) {
+			// aborted while waiting for a running job to finish
+			s.release(slot)
+			break
+		}
+		job.slot = slot
+		wg.Add(1)
+		go func(job *xargsJob) {
+			defer wg.Done()
+			defer s.release(slot)
+			runJob(job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+// acquire waits until a job can be started and returns its slot
+func (s *scheduler) acquire() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.running >= s.limit {
+		s.cond.Wait()
+	}
+	s.running++
+
+	slot := 1
+	for s.used[slot] {
+		slot++
+	}
+	s.used[slot] = true
+	return slot
+}
+
+func (s *scheduler) release(slot int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	delete(s.used, slot)
+	s.cond.Broadcast()
+}
+
+// increase allows one more job to run at a time and returns the new limit
+func (s *scheduler) increase() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit++
+	s.cond.Broadcast()
+	return s.limit
+}
+
+// decrease allows one less job to run at a time, but at least one, and returns the new limit.
+// Running jobs are not affected, new jobs wait until enough of them are finished.
+func (s *scheduler) decrease() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = max(s.limit-1, 1)
+	return s.limit
+}
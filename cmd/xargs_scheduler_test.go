@@ -0,0 +1,92 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerLimit(t *testing.T) {
+	s := newScheduler(1)
+	argch := make(chan *xargsJob, 3)
+	for i := 1; i <= 3; i++ {
+		argch <- &xargsJob{seq: i}
+	}
+	close(argch)
+
+	started := make(chan int, 3)
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.run(argch, nil, func(job *xargsJob) {
+			started <- job.seq
+			<-release
+		})
+		close(done)
+	}()
+
+	<-started
+	select {
+	case seq := <-started:
+		t.Fatalf("job %d started over the limit", seq)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// one more job can run after the limit is increased
+	if got := s.increase(); got != 2 {
+		t.Errorf("got %v want %v", got, 2)
+	}
+	<-started
+
+	release <- struct{}{}
+	release <- struct{}{}
+	<-started
+	close(release)
+	<-done
+}
+
+func TestSchedulerSlots(t *testing.T) {
+	s := newScheduler(3)
+	first, second := s.acquire(), s.acquire()
+	s.release(first)
+	third := s.acquire()
+	if first != 1 || second != 2 || third != 1 {
+		t.Errorf("got %v %v %v want %v %v %v", first, second, third, 1, 2, 1)
+	}
+}
+
+func TestSchedulerDecrease(t *testing.T) {
+	s := newScheduler(2)
+	if got := s.decrease(); got != 1 {
+		t.Errorf("got %v want %v", got, 1)
+	}
+	if got := s.decrease(); got != 1 {
+		t.Errorf("got %v want %v", got, 1)
+	}
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	argch := make(chan *xargsJob, 5)
+	for i := 1; i <= 5; i++ {
+		argch <- &xargsJob{seq: i}
+	}
+	close(argch)
+
+	s.run(argch, nil, func(job *xargsJob) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	if maxRunning != 1 {
+		t.Errorf("got %v want %v", maxRunning, 1)
+	}
+}
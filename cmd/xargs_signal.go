@@ -0,0 +1,119 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// killSwitch tells running commands to exit by sending them a signal, commands which do not exit
+// within timeoutGracePeriod are killed, see waitWithTimeout
+type killSwitch struct {
+	ch   chan struct{}
+	once sync.Once
+	mu   sync.Mutex
+	sig  syscall.Signal
+}
+
+func newKillSwitch() *killSwitch {
+	return &killSwitch{ch: make(chan struct{})}
+}
+
+// kill signals running commands and the commands started afterwards with sig, only the first call has an effect
+func (k *killSwitch) kill(sig syscall.Signal) {
+	k.once.Do(func() {
+		k.mu.Lock()
+		k.sig = sig
+		k.mu.Unlock()
+		close(k.ch)
+	})
+}
+
+// done is closed when commands should exit, it is nil for a nil switch, so that commands are never killed
+func (k *killSwitch) done() <-chan struct{} {
+	if k == nil {
+		return nil
+	}
+	return k.ch
+}
+
+func (k *killSwitch) signal() syscall.Signal {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.sig
+}
+
+// interruption records the signal xargs is interrupted by
+type interruption struct {
+	ch   chan struct{}
+	once sync.Once
+	sig  syscall.Signal
+}
+
+func newInterruption() *interruption {
+	return &interruption{ch: make(chan struct{})}
+}
+
+func (i *interruption) interrupt(sig syscall.Signal) {
+	i.once.Do(func() {
+		i.sig = sig
+		close(i.ch)
+	})
+}
+
+// exitStatus returns the conventional exit status of a process terminated by the signal e.g. 130 for SIGINT,
+// and false if xargs is not interrupted
+func (i *interruption) exitStatus() (int, bool) {
+	select {
+	case <-i.ch:
+		return 128 + int(i.sig), true
+	default:
+		return 0, false
+	}
+}
+
+// handleInterruptSignals traps SIGINT and SIGTERM until finished is closed and forwards the signal to running
+// commands, so that they also exit when only xargs is signaled, e.g. by kill. Commands run in their own process
+// groups for --timeout and --halt now do not get the signals of the terminal, the forwarded signal reaches all
+// their processes.
+// New jobs are not started after the signal.
+func handleInterruptSignals(interrupted *interruption, stop func(), kill *killSwitch, finished <-chan struct{}) {
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sigch)
+		select {
+		case <-finished:
+		case sig := <-sigch:
+			stop()
+			kill.kill(sig.(syscall.Signal))
+			interrupted.interrupt(sig.(syscall.Signal))
+		}
+	}()
+}
+
+// handleResizeSignals changes the number of commands run in parallel until finished is closed,
+// as GNU xargs, SIGUSR1 increases and SIGUSR2 decreases it
+func handleResizeSignals(sched *scheduler, finished <-chan struct{}) {
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(sigch)
+		for {
+			select {
+			case <-finished:
+				return
+			case sig := <-sigch:
+				if sig == syscall.SIGUSR2 {
+					sched.decrease()
+					continue
+				}
+				sched.increase()
+			}
+		}
+	}()
+}
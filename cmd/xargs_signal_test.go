@@ -0,0 +1,112 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterruptionExitStatus(t *testing.T) {
+	i := newInterruption()
+	if _, ok := i.exitStatus(); ok {
+		t.Errorf("got %v want %v", ok, false)
+	}
+
+	i.interrupt(syscall.SIGTERM)
+	i.interrupt(syscall.SIGINT)
+	if got, _ := i.exitStatus(); got != 143 {
+		t.Errorf("got %v want %v", got, 143)
+	}
+}
+
+func TestRunProgramKillSwitch(t *testing.T) {
+	kill := newKillSwitch()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		kill.kill(syscall.SIGINT)
+	}()
+
+	// the command exits by itself when it gets the forwarded signal
+	_, _, result, err := runProgramCollect([]string{"sh", "-c", `trap "exit 3" INT; while true; do sleep 0.1; done`}, runOptions{kill: kill})
+	if err != nil {
+		t.Errorf("Error not expected here %s", err)
+	}
+
+	if !result.killed || result.status != 0 {
+		t.Errorf("got killed %v status %v want killed with status 0", result.killed, result.status)
+	}
+
+	if result.exitCode != 3 {
+		t.Errorf("got %v want %v", result.exitCode, 3)
+	}
+}
+
+func TestSchedulerAbort(t *testing.T) {
+	s := newScheduler(1)
+	argch := make(chan *xargsJob, 2)
+	argch <- &xargsJob{seq: 1}
+	argch <- &xargsJob{seq: 2}
+
+	abort := make(chan struct{})
+	ran := make(chan int, 2)
+	s.run(argch, abort, func(job *xargsJob) {
+		ran <- job.seq
+		close(abort)
+	})
+	close(ran)
+
+	// argch is never closed, run returns since it is aborted
+	got := 0
+	for range ran {
+		got++
+	}
+	if got != 1 {
+		t.Errorf("got %v jobs run want %v", got, 1)
+	}
+}
+
+func TestRunProgramKillSwitchBackgroundChild(t *testing.T) {
+	defer func(period time.Duration) { timeoutGracePeriod = period }(timeoutGracePeriod)
+	timeoutGracePeriod = 200 * time.Millisecond
+
+	kill := newKillSwitch()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		kill.kill(syscall.SIGTERM)
+	}()
+
+	// the shell exits on the signal, but sleep keeps its output open and is not signaled,
+	// since the command runs in the process group of xargs
+	start := time.Now()
+	_, _, result, _ := runProgramCollect([]string{"sh", "-c", "sleep 3 & wait"}, runOptions{kill: kill})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("output held by a background child is waited for, took %s", elapsed)
+	}
+
+	if !result.killed {
+		t.Errorf("got %v want %v", result.killed, true)
+	}
+}
+
+func TestRunProgramBackgroundChildOutput(t *testing.T) {
+	defer func(period time.Duration) { timeoutGracePeriod = period }(timeoutGracePeriod)
+	timeoutGracePeriod = 200 * time.Millisecond
+
+	// a command leaving a background child behind succeeds, output written before it exits is kept
+	start := time.Now()
+	stdout, _, result, err := runProgramCollect([]string{"sh", "-c", "echo started; sleep 3 &"}, runOptions{})
+	if err != nil {
+		t.Errorf("Error not expected here %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("output held by a background child is waited for, took %s", elapsed)
+	}
+
+	if stdout != "started\n" || result.status != 0 {
+		t.Errorf("got %q with status %v want %q with status 0", stdout, result.status, "started\n")
+	}
+}
@@ -3,9 +3,18 @@ package cmd
 import (
 	"bufio"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
 )
 
 func TestXargsFlagParse(t *testing.T) {
@@ -15,22 +24,45 @@ func TestXargsFlagParse(t *testing.T) {
 		expectedFlags    xargsFlags
 		expectedRestArgs []string
 	}{
-		{"all flags set and command exists", []string{"-n", "3", "-P", "4", "-0", "--exit-on-error", "-I", "{}", "grep", "-l"}, xargsFlags{delimiter: zeroDelimiter, maxProcs: 4, maxArgs: 1, replacement: "{}", exitOnError: true}, []string{"grep", "-l"}},
+		{"all flags set and command exists", []string{"-n", "3", "-P", "4", "-0", "--exit-on-error", "-I", "{}", "grep", "-l"}, xargsFlags{delimiter: zeroDelimiter, maxProcs: 4, maxArgs: 1, replacement: "{}", halt: haltPolicy{when: haltSoon, count: 1}}, []string{"grep", "-l"}},
 		{"all long flags set and command exists", []string{"--max-args", "3", "--max-procs", "4", "-0", "grep", "-l"}, xargsFlags{delimiter: zeroDelimiter, maxProcs: 4, maxArgs: 3}, []string{"grep", "-l"}},
 		{"no max procs and, command exists", []string{"-n", "3", "-0", "grep", "-l"}, xargsFlags{delimiter: zeroDelimiter, maxProcs: 1, maxArgs: 3}, []string{"grep", "-l"}},
-		{"no max procs, no zero delimited and command exists", []string{"-n", "3", "grep", "-l"}, xargsFlags{delimiter: newLineDelimiter, maxProcs: 1, maxArgs: 3}, []string{"grep", "-l"}},
-		{"only command exists", []string{"grep", "-l"}, xargsFlags{delimiter: newLineDelimiter, maxProcs: 1, maxArgs: 1}, []string{"grep", "-l"}},
+		{"no max procs, no zero delimited and command exists", []string{"-n", "3", "grep", "-l"}, xargsFlags{maxProcs: 1, maxArgs: 3}, []string{"grep", "-l"}},
+		{"only command exists", []string{"grep", "-l"}, xargsFlags{maxProcs: 1, maxArgs: 1}, []string{"grep", "-l"}},
+		{"max chars set and command exists", []string{"-s", "1024", "-n", "10", "grep"}, xargsFlags{maxProcs: 1, maxArgs: 10, maxChars: 1024}, []string{"grep"}},
+		{"delimiter, max lines and eof set and command exists", []string{"-d", `\n`, "-L", "2", "-E", "END", "echo"}, xargsFlags{delimiter: "\n", maxProcs: 1, maxArgs: 1, maxLines: 2, eofString: "END"}, []string{"echo"}},
+		{"verbose and interactive set and command exists", []string{"-t", "--interactive", "rm"}, xargsFlags{maxProcs: 1, maxArgs: 1, verbose: true, interactive: true}, []string{"rm"}},
+		{"arg file and no run if empty set and command exists", []string{"-a", "args.txt", "-r", "echo"}, xargsFlags{maxProcs: 1, maxArgs: 1, argFile: "args.txt", noRunIfEmpty: true}, []string{"echo"}},
+		{"keep order set and command exists", []string{"-P", "4", "--keep-order", "grep"}, xargsFlags{maxProcs: 4, maxArgs: 1, keepOrder: true}, []string{"grep"}},
+		{"timeout set and command exists", []string{"--timeout", "1m30s", "sleep"}, xargsFlags{maxProcs: 1, maxArgs: 1, timeout: 90 * time.Second}, []string{"sleep"}},
+		{"tagstring set and command exists", []string{"--tagstring", "[{}]", "echo"}, xargsFlags{maxProcs: 1, maxArgs: 1, tag: true, tagString: "[{}]"}, []string{"echo"}},
+		{"pipe and block size set and command exists", []string{"--pipe", "--block", "10k", "gzip"}, xargsFlags{maxProcs: 1, maxArgs: 1, pipe: true, blockSize: 10000}, []string{"gzip"}},
+		{"halt set and command exists", []string{"--halt", "now,fail=20%", "grep"}, xargsFlags{maxProcs: 1, maxArgs: 1, halt: haltPolicy{when: haltNow, count: 20, percent: true}}, []string{"grep"}},
+		{"load and memfree set and command exists", []string{"--load", "2.5", "--memfree", "1G", "make"}, xargsFlags{maxProcs: 1, maxArgs: 1, maxLoad: 2.5, memFree: 1000000000}, []string{"make"}},
+		{"retries and retry delay set and command exists", []string{"--retries", "3", "--retry-delay", "500ms", "curl"}, xargsFlags{maxProcs: 1, maxArgs: 1, retries: 3, retryDelay: 500 * time.Millisecond}, []string{"curl"}},
+		{"dry run, workdir and env set and command exists", []string{"--dry-run", "-C", "{//}", "--env", "A=1", "--env", "B=", "make"}, xargsFlags{maxProcs: 1, maxArgs: 1, dryRun: true, workdir: "{//}", env: []string{"A=1", "B="}}, []string{"make"}},
+		{"progress and eta set and command exists", []string{"--progress", "--eta", "make"}, xargsFlags{maxProcs: 1, maxArgs: 1, progress: true, eta: true}, []string{"make"}},
+		{"results set and command exists", []string{"--results", "out.csv", "make"}, xargsFlags{maxProcs: 1, maxArgs: 1, results: "out.csv"}, []string{"make"}},
+		{"flags after command are passed to command", []string{"-P", "2", "echo", "-n", "-P", "3", "--help"}, xargsFlags{maxProcs: 2, maxArgs: 1}, []string{"echo", "-n", "-P", "3", "--help"}},
+		{"combined short flags set and command exists", []string{"-0rt", "echo"}, xargsFlags{delimiter: zeroDelimiter, maxProcs: 1, maxArgs: 1, noRunIfEmpty: true, verbose: true}, []string{"echo"}},
+		{"tokens set and command exists", []string{"-n", "2", "--tokens", "echo", "{.}"}, xargsFlags{maxProcs: 1, maxArgs: 1, tokens: true}, []string{"echo", "{.}"}},
+		{"bool flags set to false", []string{"--no-run-if-empty=false", "--null=false", "-k=false", "--exit-on-error=false", "echo"}, xargsFlags{maxProcs: 1, maxArgs: 1}, []string{"echo"}},
+		{"help and flags of command are passed to command", []string{"echo", "--help", "-n", "3"}, xargsFlags{maxProcs: 1, maxArgs: 1}, []string{"echo", "--help", "-n", "3"}},
+		{"obsolete replace flag set and command exists", []string{"-i", "%", "echo"}, xargsFlags{maxProcs: 1, maxArgs: 1, replacement: "%"}, []string{"echo"}},
+		{"joblog and resume failed set and command exists", []string{"--joblog", "jobs.log", "--resume-failed", "echo"}, xargsFlags{maxProcs: 1, maxArgs: 1, joblog: "jobs.log", resume: resumeFailed}, []string{"echo"}},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			f := newXargsFlags()
-			got, err := f.parseFlags(c.input)
-			if err != nil {
-				t.Errorf("Error not expected here %s", err)
+			if c.expectedFlags.blockSize == 0 {
+				c.expectedFlags.blockSize = defaultBlockSize
+			}
+			f, got, err := executeXargsCmd(c.input, io.Discard)
+			if err != nil || f == nil {
+				t.Fatalf("Error not expected here %s", err)
 			}
 
-			if *f != c.expectedFlags {
+			if !reflect.DeepEqual(*f, c.expectedFlags) {
 				t.Errorf("got %v want %v", *f, c.expectedFlags)
 			}
 
@@ -50,12 +82,20 @@ func TestXargsFlagsParseInvalid(t *testing.T) {
 		{"invalid max-procs (not number) and command exists", []string{"-n", "3", "-P", "aaa", "-0", "grep", "-l"}, errInvalidArgument},
 		{"invalid max-procs (missing) and command exists", []string{"-n", "3", "-P", "-0", "grep", "-l"}, errMissingArgument},
 		{"command does not exists", []string{"-n", "3", "-0"}, errNoCommandSpecified},
+		{"invalid timeout and command exists", []string{"--timeout", "10", "sleep"}, errInvalidArgument},
+		{"invalid delimiter and command exists", []string{"-d", "ab", "echo"}, errInvalidDelimiter},
+		{"invalid block size and command exists", []string{"--pipe", "--block", "0", "gzip"}, errInvalidArgument},
+		{"invalid halt and command exists", []string{"--halt", "now", "grep"}, errInvalidHalt},
+		{"invalid load and command exists", []string{"--load", "high", "make"}, errInvalidArgument},
+		{"invalid memfree and command exists", []string{"--memfree", "lots", "make"}, errInvalidArgument},
+		{"invalid env and command exists", []string{"--env", "A", "make"}, errInvalidArgument},
+		{"resume without joblog and command exists", []string{"--resume", "echo"}, errJobLogRequired},
+		{"missing replacement and command exists", []string{"-I", "-t", "echo"}, errMissingArgument},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			f := newXargsFlags()
-			_, err := f.parseFlags(c.input)
+			_, _, err := executeXargsCmd(c.input, io.Discard)
 
 			if err == nil {
 				t.Errorf("Error expected here")
@@ -69,12 +109,57 @@ func TestXargsFlagsParseInvalid(t *testing.T) {
 	}
 }
 
+func TestXargsCmdHelp(t *testing.T) {
+	var out strings.Builder
+	f, _, err := executeXargsCmd([]string{"--help"}, &out)
+	if err != nil {
+		t.Errorf("Error not expected here %s", err)
+	}
+
+	if f != nil {
+		t.Errorf("command is run for help")
+	}
+
+	if !strings.Contains(out.String(), "-P, --max-procs n") {
+		t.Errorf("got %q want usage of flags", out.String())
+	}
+}
+
+func TestXargsCmdRegistered(t *testing.T) {
+	c, _, err := rootCmd.Find([]string{"xargs", "echo", "--help"})
+	if err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+
+	if c.Name() != "xargs" {
+		t.Errorf("got %v want %v", c.Name(), "xargs")
+	}
+}
+
+// executeXargsCmd runs the xargs command with args through the command tree as main does,
+// it returns the flags and the arguments the command would be run with, nil flags if it is not run
+func executeXargsCmd(args []string, out io.Writer) (*xargsFlags, []string, error) {
+	var gotFlags *xargsFlags
+	var gotArgs []string
+	root := &cobra.Command{Use: "cmdtools"}
+	root.AddCommand(newXargsCmd(func(args []string, flags *xargsFlags) error {
+		gotArgs, gotFlags = args, flags
+		return nil
+	}))
+	root.SetArgs(append([]string{"xargs"}, args...))
+	root.SetOut(out)
+	root.SetErr(out)
+	err := root.Execute()
+	return gotFlags, gotArgs, err
+}
+
 func TestPassBySingle(t *testing.T) {
 	cases := []struct {
 		name             string
 		inputArgs        []string
 		inputStdin       string
 		inputReplacement string
+		inputTokens      bool
 		want             [][]string
 	}{
 		{
@@ -82,6 +167,7 @@ func TestPassBySingle(t *testing.T) {
 			[]string{"grep", "foo"},
 			"file1.txt\nfile2.txt",
 			"",
+			false,
 			[][]string{{"grep", "foo", "file1.txt"}, {"grep", "foo", "file2.txt"}},
 		},
 		{
@@ -89,6 +175,7 @@ func TestPassBySingle(t *testing.T) {
 			[]string{"mv", "{}", "/tmp/"},
 			"file1.txt\nfile2.txt",
 			"{}",
+			false,
 			[][]string{{"mv", "file1.txt", "/tmp/"}, {"mv", "file2.txt", "/tmp/"}},
 		},
 		{
@@ -96,19 +183,52 @@ func TestPassBySingle(t *testing.T) {
 			[]string{"mv", "{}", "{}.bck"},
 			"file1.txt\nfile2.txt",
 			"{}",
+			false,
 			[][]string{{"mv", "file1.txt", "file1.txt.bck"}, {"mv", "file2.txt", "file2.txt.bck"}},
 		},
+		{
+			"replacement and tokens exist",
+			[]string{"mv", "%", "{/.}-{#}.bck"},
+			"dir/file1.txt\nfile2.txt",
+			"%",
+			true,
+			[][]string{{"mv", "dir/file1.txt", "file1-1.bck"}, {"mv", "file2.txt", "file2-2.bck"}},
+		},
+		{
+			"only replacement is replaced without tokens",
+			[]string{"echo", "X", "{}", "{.}"},
+			"hello",
+			"X",
+			false,
+			[][]string{{"echo", "hello", "{}", "{.}"}},
+		},
+		{
+			"tokens without replacement",
+			[]string{"echo", "{}", "{.}"},
+			"file.txt",
+			"",
+			true,
+			[][]string{{"echo", "file.txt", "file"}},
+		},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			scanner := bufio.NewScanner(strings.NewReader(c.inputStdin))
-			ch := make(chan []string, len(c.want))
-			passBySingle(scanner, c.inputArgs, ch, nil, c.inputReplacement)
+			ch := make(chan *xargsJob, len(c.want))
+			var tokens *tokenExpander
+			if len(c.inputReplacement) != 0 || c.inputTokens {
+				tokens = newTokenExpander(c.inputReplacement, c.inputTokens, nil)
+			}
+			passBySingle(scanner, c.inputArgs, ch, nil, tokens, 0)
+			close(ch)
 
 			got := make([][]string, 0, len(c.want))
 			for v := range ch {
-				got = append(got, v)
+				if v.seq != len(got)+1 {
+					t.Errorf("got seq %v want %v", v.seq, len(got)+1)
+				}
+				got = append(got, v.args)
 			}
 
 			if !reflect.DeepEqual(got, c.want) {
@@ -120,17 +240,19 @@ func TestPassBySingle(t *testing.T) {
 
 func TestPassByMultiple(t *testing.T) {
 	cases := []struct {
-		name         string
-		inputArgs    []string
-		inputStdin   string
-		inputMaxArgs int
-		want         [][]string
+		name          string
+		inputArgs     []string
+		inputStdin    string
+		inputMaxArgs  int
+		inputMaxChars int
+		want          [][]string
 	}{
 		{
 			"less than maxArgs exists",
 			[]string{"grep", "foo"},
 			"file1.txt",
 			2,
+			0,
 			[][]string{{"grep", "foo", "file1.txt"}},
 		},
 		{
@@ -138,6 +260,7 @@ func TestPassByMultiple(t *testing.T) {
 			[]string{"grep", "foo"},
 			"file1.txt\nfile2.txt\nfile3.txt\nfile4.txt",
 			2,
+			0,
 			[][]string{{"grep", "foo", "file1.txt", "file2.txt"}, {"grep", "foo", "file3.txt", "file4.txt"}},
 		},
 		{
@@ -145,6 +268,16 @@ func TestPassByMultiple(t *testing.T) {
 			[]string{"grep", "foo"},
 			"file1.txt\nfile2.txt\nfile3.txt",
 			2,
+			0,
+			[][]string{{"grep", "foo", "file1.txt", "file2.txt"}, {"grep", "foo", "file3.txt"}},
+		},
+		{
+			"limited by max chars",
+			[]string{"grep", "foo"},
+			"file1.txt\nfile2.txt\nfile3.txt",
+			3,
+			// "grep foo file1.txt file2.txt" with terminating NULs
+			29,
 			[][]string{{"grep", "foo", "file1.txt", "file2.txt"}, {"grep", "foo", "file3.txt"}},
 		},
 	}
@@ -152,12 +285,16 @@ func TestPassByMultiple(t *testing.T) {
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			scanner := bufio.NewScanner(strings.NewReader(c.inputStdin))
-			ch := make(chan []string, len(c.want))
-			passByMultiple(scanner, c.inputArgs, ch, nil, c.inputMaxArgs)
+			ch := make(chan *xargsJob, len(c.want))
+			passByMultiple(scanner, c.inputArgs, ch, nil, c.inputMaxArgs, c.inputMaxChars)
+			close(ch)
 
 			got := make([][]string, 0, len(c.want))
 			for v := range ch {
-				got = append(got, v)
+				if v.seq != len(got)+1 {
+					t.Errorf("got seq %v want %v", v.seq, len(got)+1)
+				}
+				got = append(got, v.args)
 			}
 
 			if !reflect.DeepEqual(got, c.want) {
@@ -166,3 +303,584 @@ func TestPassByMultiple(t *testing.T) {
 		})
 	}
 }
+
+func TestPassArgLineTooLong(t *testing.T) {
+	ch := make(chan *xargsJob, 2)
+	scanner := bufio.NewScanner(strings.NewReader("file1.txt\na_very_long_file_name.txt"))
+	err := passBySingle(scanner, []string{"grep", "foo"}, ch, nil, nil, 20)
+	if !errors.Is(err, errArgLineTooLong) {
+		t.Errorf("got %v want %v", err, errArgLineTooLong)
+	}
+
+	ch = make(chan *xargsJob, 2)
+	scanner = bufio.NewScanner(strings.NewReader("file1.txt\na_very_long_file_name.txt"))
+	err = passByMultiple(scanner, []string{"grep", "foo"}, ch, nil, 2, 20)
+	close(ch)
+	if !errors.Is(err, errArgLineTooLong) {
+		t.Errorf("got %v want %v", err, errArgLineTooLong)
+	}
+
+	// arguments before the too long one are still passed
+	got := make([][]string, 0)
+	for v := range ch {
+		got = append(got, v.args)
+	}
+	want := [][]string{{"grep", "foo", "file1.txt"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestRunProgramTimeout(t *testing.T) {
+	start := time.Now()
+	// the shell starts sleep as a child, so killing only the shell would leave sleep holding the output pipe
+	stdout, stderr, _, err := runProgramCollect([]string{"sh", "-c", "sleep 10; echo done"}, runOptions{timeout: 100 * time.Millisecond, processGroup: true})
+	elapsed := time.Since(start)
+
+	if stdout != "" {
+		t.Errorf("got %v want empty stdout", stdout)
+	}
+
+	if stderr != "" {
+		t.Errorf("got %v want empty stderr", stderr)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("got %v want timed out error", err)
+	}
+
+	if elapsed > 5*time.Second {
+		t.Errorf("process group was not killed in time, took %s", elapsed)
+	}
+}
+
+func TestRunProgramProcessGroup(t *testing.T) {
+	// the fifth field of /proc/<pid>/stat is the process group, the name of the shell has no spaces
+	script := []string{"sh", "-c", `echo $$ $(cut -d " " -f 5 /proc/$$/stat)`}
+	cases := []struct {
+		name         string
+		processGroup bool
+	}{
+		{"in process group of xargs", false},
+		{"in own process group", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stdout, _, _, err := runProgramCollect(script, runOptions{processGroup: c.processGroup})
+			if err != nil {
+				t.Fatalf("Error not expected here %s", err)
+			}
+
+			pid, pgid, _ := strings.Cut(strings.TrimSpace(stdout), " ")
+			want := strconv.Itoa(syscall.Getpgrp())
+			if c.processGroup {
+				want = pid
+			}
+			if pgid != want {
+				t.Errorf("got %v want %v", pgid, want)
+			}
+		})
+	}
+}
+
+func TestRunProgramBinaryOutput(t *testing.T) {
+	cases := []struct {
+		name       string
+		lineBuffer bool
+	}{
+		{"unbuffered", false},
+		{"line buffered", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stdout, _, _, err := runProgramCollect([]string{"printf", `a\000b\nc`}, runOptions{lineBuffer: c.lineBuffer})
+			if err != nil {
+				t.Errorf("Error not expected here %s", err)
+			}
+
+			want := "a\u0000b\nc"
+			if stdout != want {
+				t.Errorf("got %q want %q", stdout, want)
+			}
+		})
+	}
+}
+
+func TestStreamWriterLineBuffer(t *testing.T) {
+	ch := make(chan jobOutput, 10)
+	w := &streamWriter{ch: ch, lineBuffer: true}
+
+	w.Write([]byte("ab"))
+	w.Write([]byte("c\nde"))
+	w.Write([]byte("f\ng\nh"))
+	w.flush()
+	close(ch)
+
+	got := make([]string, 0)
+	for v := range ch {
+		got = append(got, v.data)
+	}
+
+	want := []string{"abc\n", "def\ng\n", "h"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestStreamWriterTag(t *testing.T) {
+	ch := make(chan jobOutput, 10)
+	w := &streamWriter{ch: ch, tag: "a\t"}
+
+	w.Write([]byte("x\ny"))
+	w.Write([]byte("z\n\nw"))
+	w.flush()
+	close(ch)
+
+	var got strings.Builder
+	for v := range ch {
+		got.WriteString(v.data)
+	}
+
+	want := "a\tx\na\tyz\na\t\na\tw"
+	if got.String() != want {
+		t.Errorf("got %q want %q", got.String(), want)
+	}
+}
+
+func TestExpandTag(t *testing.T) {
+	job := &xargsJob{seq: 7, args: []string{"echo", "a", "b"}, input: []string{"a", "b"}}
+	cases := []struct {
+		name        string
+		template    string
+		replacement string
+		want        string
+	}{
+		{"input replaces braces", "{}", "", "a b\t"},
+		{"input replaces replacement string", "<%>:{}", "%", "<a b>:a b\t"},
+		{"job number replaces token", "{#}", "", "7\t"},
+		{"template without tokens", "job", "", "job\t"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := expandTag(c.template, job, newTokenExpander(c.replacement, false, nil))
+			if got != c.want {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRunProgramExitStatus(t *testing.T) {
+	notExecutable := filepath.Join(t.TempDir(), "script.sh")
+	os.WriteFile(notExecutable, []byte("echo hello"), 0644)
+
+	cases := []struct {
+		name  string
+		input []string
+		want  int
+	}{
+		{"success", []string{"true"}, 0},
+		{"failure", []string{"sh", "-c", "exit 3"}, exitStatusFailed},
+		{"exit with 255", []string{"sh", "-c", "exit 255"}, exitStatusCommand255},
+		{"killed by signal", []string{"sh", "-c", "kill -9 $$"}, exitStatusSignaled},
+		{"not executable", []string{notExecutable}, exitStatusCannotRun},
+		{"not found in path", []string{"cmdtools-command-does-not-exist"}, exitStatusNotFound},
+		{"not found", []string{"./cmdtools-command-does-not-exist"}, exitStatusNotFound},
+		{"timed out", []string{"sleep", "10"}, exitStatusFailed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, got, _ := runProgramCollect(c.input, runOptions{timeout: time.Second})
+			if got.status != c.want {
+				t.Errorf("got %v want %v", got.status, c.want)
+			}
+		})
+	}
+}
+
+func TestRunProgramFailureByExitCode(t *testing.T) {
+	cases := []struct {
+		name       string
+		input      []string
+		wantStdout string
+		wantStderr string
+		wantErr    string
+	}{
+		{"success with stderr output", []string{"sh", "-c", "echo out; echo warning >&2"}, "out\n", "warning\n", ""},
+		{"failure without stderr output", []string{"sh", "-c", "echo out; exit 3"}, "out\n", "", "exited with status 3: sh -c echo out; exit 3"},
+		{"failure with stderr output", []string{"sh", "-c", "echo out; echo failed >&2; exit 1"}, "out\n", "failed\n", "exited with status 1"},
+		{"killed by signal", []string{"sh", "-c", "kill -9 $$"}, "", "", "killed by signal 9"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stdout, stderr, _, err := runProgramCollect(c.input, runOptions{})
+			if stdout != c.wantStdout {
+				t.Errorf("got %q want %q", stdout, c.wantStdout)
+			}
+
+			if stderr != c.wantStderr {
+				t.Errorf("got %q want %q", stderr, c.wantStderr)
+			}
+
+			if len(c.wantErr) == 0 && err != nil {
+				t.Errorf("Error not expected here %s", err)
+			}
+
+			if len(c.wantErr) != 0 && (err == nil || !strings.Contains(err.Error(), c.wantErr)) {
+				t.Errorf("got %v want %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestOutputOrderer(t *testing.T) {
+	window := make(chan struct{}, 3)
+	for i := 0; i < 3; i++ {
+		window <- struct{}{}
+	}
+
+	got := make([]string, 0)
+	o := newOutputOrderer(func(out jobOutput) {
+		if !out.done {
+			got = append(got, out.data)
+		}
+	}, window)
+
+	outputs := []jobOutput{
+		{seq: 2, data: "2a"},
+		{seq: 1, data: "1a"},
+		{seq: 3, data: "3a"},
+		{seq: 2, data: "2b"},
+		{seq: 0, data: "message"},
+		{seq: 3, done: true},
+		{seq: 2, done: true},
+		{seq: 1, data: "1b"},
+		{seq: 1, done: true},
+	}
+	for _, out := range outputs {
+		o.add(out)
+	}
+
+	want := []string{"1a", "message", "1b", "2a", "2b", "3a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	if len(window) != 0 {
+		t.Errorf("got %v want %v free slots taken back", len(window), 0)
+	}
+
+	if len(o.pending) != 0 {
+		t.Errorf("got %v want no pending output", o.pending)
+	}
+}
+
+// runProgramCollect runs the command and returns everything it has written to stdout and stderr
+func TestRunWithRetries(t *testing.T) {
+	cases := []struct {
+		name         string
+		command      string
+		retries      int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"succeeds after retries", "sh", 2, false, 3},
+		{"fails after final attempt", "sh", 1, true, 2},
+		{"command not found is not retried", "does_not_exist_command", 2, true, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			counter := filepath.Join(t.TempDir(), "attempts")
+			// fails until the third attempt
+			script := fmt.Sprintf("echo >> %s; test $(wc -l < %s) -ge 3", counter, counter)
+
+			outch := make(chan jobOutput, 10)
+			r := &jobRunner{outch: outch, opts: runOptions{retries: c.retries, retryDelay: time.Millisecond}}
+			_, err := r.runWithRetries(&xargsJob{seq: 1, args: []string{c.command, "-c", script}})
+			close(outch)
+
+			if (err != nil) != c.wantErr {
+				t.Errorf("got %v want error %v", err, c.wantErr)
+			}
+
+			retries := 0
+			for out := range outch {
+				if strings.HasPrefix(out.data, "attempt ") {
+					retries++
+				}
+			}
+			if retries != max(c.wantAttempts-1, 0) {
+				t.Errorf("got %v retries want %v", retries, max(c.wantAttempts-1, 0))
+			}
+
+			data, _ := os.ReadFile(counter)
+			if got := strings.Count(string(data), "\n"); got != c.wantAttempts {
+				t.Errorf("got %v attempts want %v", got, c.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRunProgramWorkdirAndEnv(t *testing.T) {
+	dir := t.TempDir()
+	opts := runOptions{workdir: "{}", env: []string{"XARGS_TEST=value"}, tokens: newTokenExpander("", false, nil)}
+	job := &xargsJob{seq: 4, slot: 2, args: []string{"sh", "-c", "pwd; echo $XARGS_TEST $XARGS_SLOT $XARGS_JOB"}, input: []string{dir}}
+
+	outch := make(chan jobOutput, 10)
+	_, err := runProgram(job, opts, outch)
+	close(outch)
+	if err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+
+	var got strings.Builder
+	for out := range outch {
+		got.WriteString(out.data)
+	}
+
+	want := dir + "\nvalue 2 4\n"
+	if got.String() != want {
+		t.Errorf("got %q want %q", got.String(), want)
+	}
+}
+
+func TestRunJobDryRun(t *testing.T) {
+	outch := make(chan jobOutput, 10)
+	r := &jobRunner{outch: outch, opts: runOptions{dryRun: true}}
+	r.runJob(&xargsJob{seq: 1, args: []string{"rm", "a file"}})
+	close(outch)
+
+	var got []jobOutput
+	for out := range outch {
+		got = append(got, out)
+	}
+
+	want := []jobOutput{{seq: 1, data: "rm 'a file'\n"}, {seq: 1, done: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestDryRunCommandLine(t *testing.T) {
+	job := &xargsJob{seq: 1, args: []string{"ls", "/tmp/a b"}, input: []string{"/tmp/a b"}}
+	cases := []struct {
+		name string
+		opts runOptions
+		want string
+	}{
+		{"command only", runOptions{}, "ls '/tmp/a b'"},
+		{"expanded workdir", runOptions{workdir: "{}", tokens: newTokenExpander("", false, nil)}, "cd '/tmp/a b' && ls '/tmp/a b'"},
+		{"env", runOptions{env: []string{"A=1", "B=x y", "C="}}, "A=1 B='x y' C='' ls '/tmp/a b'"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := dryRunCommandLine(job, c.opts)
+			if got != c.want {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSystemMaxCharsEnv(t *testing.T) {
+	_, envSize, _, err := systemMaxChars(nil)
+	if err != nil {
+		t.Fatalf("Error not expected here %s", err)
+	}
+
+	// variables of every job are accounted for
+	if want := commandLineLength(os.Environ()) + maxJobEnvSize; envSize != want {
+		t.Errorf("got %v want %v", envSize, want)
+	}
+
+	extra := []string{"A=" + strings.Repeat("x", 1000)}
+	_, got, _, _ := systemMaxChars(extra)
+	if got != envSize+1003 {
+		t.Errorf("got %v want %v", got, envSize+1003)
+	}
+}
+
+func runProgramCollect(commandAndArgs []string, opts runOptions) (stdout string, stderr string, result jobResult, err error) {
+	outch := make(chan jobOutput)
+	done := make(chan struct{})
+	var out, errout strings.Builder
+	go func() {
+		for o := range outch {
+			if o.stderr {
+				errout.WriteString(o.data)
+				continue
+			}
+			out.WriteString(o.data)
+		}
+		close(done)
+	}()
+
+	result, err = runProgram(&xargsJob{seq: 1, args: commandAndArgs}, opts, outch)
+	close(outch)
+	<-done
+	return out.String(), errout.String(), result, err
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := []struct {
+		name  string
+		input []string
+		want  string
+	}{
+		{"safe arguments", []string{"grep", "-l", "foo", "/tmp/file_1.txt"}, "grep -l foo /tmp/file_1.txt"},
+		{"arguments with blanks", []string{"echo", "a b", "c\td"}, "echo 'a b' 'c\td'"},
+		{"empty argument", []string{"echo", ""}, "echo ''"},
+		{"arguments with quotes and special characters", []string{"echo", "it's", "$HOME", "*"}, `echo 'it'\''s' '$HOME' '*'`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := shellQuote(c.input)
+			if got != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPrompterConfirm(t *testing.T) {
+	var out strings.Builder
+	p := newPrompter(strings.NewReader("y\nn\nYes\n\n"), &out)
+
+	got := []bool{p.confirm("echo a"), p.confirm("echo b"), p.confirm("echo c"), p.confirm("echo d"), p.confirm("echo e")}
+	want := []bool{true, false, true, false, false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	wantOut := "echo a ?...echo b ?...echo c ?...echo d ?...echo e ?..."
+	if out.String() != wantOut {
+		t.Errorf("got %v want %v", out.String(), wantOut)
+	}
+}
+
+func TestProcessEmptyInput(t *testing.T) {
+	emptyFile := filepath.Join(t.TempDir(), "empty.txt")
+	os.WriteFile(emptyFile, []byte("  \n"), 0644)
+
+	cases := []struct {
+		name         string
+		noRunIfEmpty bool
+		want         int
+	}{
+		{"run once when input is empty", false, exitStatusFailed},
+		{"do not run when input is empty", true, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			flags := newXargsFlags()
+			flags.argFile = emptyFile
+			flags.noRunIfEmpty = c.noRunIfEmpty
+
+			// command fails if it is run, so that exit status tells whether it is run
+			got := process([]string{"false"}, flags)
+			if got != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestProcessBracesInCommand(t *testing.T) {
+	dir := t.TempDir()
+	matching := filepath.Join(dir, "aa.txt")
+	os.WriteFile(matching, []byte("aa\n"), 0644)
+
+	cases := []struct {
+		name  string
+		input string
+		args  []string
+		// file created by the command, if any
+		created string
+	}{
+		// braces of a regular expression are not a column token, input is appended as a file name
+		{"grep interval", matching, []string{"grep", "-q", "-E", "a{2}"}, ""},
+		// braces of find are kept for find, input is appended as a find expression
+		{"find exec", "-true", []string{"find", dir, "-maxdepth", "0", "-exec", "touch", "{}/found", ";"}, filepath.Join(dir, "found")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			argFile := filepath.Join(t.TempDir(), "args.txt")
+			os.WriteFile(argFile, []byte(c.input+"\n"), 0644)
+
+			flags := newXargsFlags()
+			flags.argFile = argFile
+			flags.delimiter = "\n"
+
+			got := process(c.args, flags)
+			if got != 0 {
+				t.Errorf("got %v want %v", got, 0)
+			}
+
+			if len(c.created) != 0 {
+				if _, err := os.Stat(c.created); err != nil {
+					t.Errorf("Error not expected here %s", err)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessTokensOfLines(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		colsep string
+		args   []string
+	}{
+		{"tab column separator", "a\tb\n", `\t`, []string{"sh", "-c", `test "$0" = a && test "$1" = b`, "{1}", "{2}"}},
+		{"space column separator", "a b\n", " ", []string{"sh", "-c", `test "$0" = a && test "$1" = b`, "{1}", "{2}"}},
+		{"name with space", "dir/a b.txt\n", "", []string{"sh", "-c", `test "$0" = "dir/a b" && test "$1" = "a b.txt"`, "{.}", "{/}"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			argFile := filepath.Join(t.TempDir(), "args.txt")
+			os.WriteFile(argFile, []byte(c.input), 0644)
+
+			flags := newXargsFlags()
+			flags.argFile = argFile
+			flags.tokens = true
+			flags.colsep = c.colsep
+
+			// the command fails unless it gets the expected values
+			got := process(c.args, flags)
+			if got != 0 {
+				t.Errorf("got %v want %v", got, 0)
+			}
+		})
+	}
+}
+
+func TestProcessArgFile(t *testing.T) {
+	argFile := filepath.Join(t.TempDir(), "args.txt")
+	os.WriteFile(argFile, []byte("0\n3\n"), 0644)
+
+	flags := newXargsFlags()
+	flags.argFile = argFile
+
+	got := process([]string{"sh", "-c", "exit $0"}, flags)
+	if got != exitStatusFailed {
+		t.Errorf("got %v want %v", got, exitStatusFailed)
+	}
+
+	flags.argFile = filepath.Join(t.TempDir(), "does_not_exist.txt")
+	got = process([]string{"true"}, flags)
+	if got != 1 {
+		t.Errorf("got %v want %v", got, 1)
+	}
+}
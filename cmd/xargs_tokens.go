@@ -0,0 +1,132 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// replacement tokens of GNU parallel, a number is a column of input split by --colsep
+const replacementTokenPattern = `\{(|\.|/|//|/\.|#|%|[1-9][0-9]*)\}`
+
+// tokenExpander replaces GNU parallel style tokens in command arguments and tag templates with values of a job:
+//
+//	{}   input
+//	{.}  input without extension
+//	{/}  base name of input
+//	{//} directory of input
+//	{/.} base name of input without extension
+//	{#}  sequence number of the job
+//	{%}  slot of the job, between 1 and the number of parallel processes
+//	{N}  Nth column of input split by --colsep, the whole input if no separator is given
+//
+// The replacement string of -I, if any, is replaced with the input as {} is.
+// Templates of xargs flags, like --tagstring, are always expanded. Command arguments are only
+// expanded when asked for, see newTokenExpander, since they may contain braces of their own
+// e.g. grep -E 'a{2}' or find -exec cmd {} \;.
+type tokenExpander struct {
+	re          *regexp.Regexp
+	replacement string
+	// what is replaced in command arguments, nil if input is appended to them instead
+	argRe  *regexp.Regexp
+	colsep *regexp.Regexp
+}
+
+// newTokenExpander returns an expander replacing only the replacement string in command arguments as
+// -I of xargs does, or all tokens if allTokens is set (--tokens). If there is neither, command arguments are not expanded.
+func newTokenExpander(replacement string, allTokens bool, colsep *regexp.Regexp) *tokenExpander {
+	pattern := replacementTokenPattern
+	if len(replacement) != 0 && replacement != "{}" {
+		// replace both in a single pass, so that input containing tokens is not expanded again
+		pattern = regexp.QuoteMeta(replacement) + "|" + pattern
+	}
+	t := &tokenExpander{re: regexp.MustCompile(pattern), replacement: replacement, colsep: colsep}
+	if allTokens {
+		t.argRe = t.re
+	} else if len(replacement) != 0 {
+		t.argRe = regexp.MustCompile(regexp.QuoteMeta(replacement))
+	}
+	return t
+}
+
+// replacesArgs reports whether input replaces tokens in command arguments instead of being appended to them
+func (t *tokenExpander) replacesArgs() bool {
+	return t.argRe != nil
+}
+
+// usesSlot reports whether {%} is expanded in any of the command arguments
+func (t *tokenExpander) usesSlot(args []string) bool {
+	if t.argRe != t.re {
+		return false
+	}
+	for _, arg := range args {
+		if strings.Contains(arg, "{%}") {
+			return true
+		}
+	}
+	return false
+}
+
+// expand replaces the tokens in the template s with the values of the job
+func (t *tokenExpander) expand(s string, job *xargsJob) string {
+	return t.replace(t.re, s, job)
+}
+
+// expandArg replaces the tokens in the command argument s with the values of the job, see newTokenExpander
+func (t *tokenExpander) expandArg(s string, job *xargsJob) string {
+	return t.replace(t.argRe, s, job)
+}
+
+// expandArgs returns the command arguments with the tokens replaced with the values of the job
+func (t *tokenExpander) expandArgs(args []string, job *xargsJob) []string {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = t.expandArg(arg, job)
+	}
+	return expanded
+}
+
+func (t *tokenExpander) replace(re *regexp.Regexp, s string, job *xargsJob) string {
+	input := strings.Join(job.input, " ")
+	return re.ReplaceAllStringFunc(s, func(token string) string {
+		if token == t.replacement {
+			return input
+		}
+
+		switch name := token[1 : len(token)-1]; name {
+		case "":
+			return input
+		case ".":
+			return withoutExtension(input)
+		case "/":
+			return filepath.Base(input)
+		case "//":
+			return filepath.Dir(input)
+		case "/.":
+			return withoutExtension(filepath.Base(input))
+		case "#":
+			return strconv.Itoa(job.seq)
+		case "%":
+			return strconv.Itoa(job.slot)
+		default:
+			// pattern allows only numbers starting from 1 here
+			n, _ := strconv.Atoi(name)
+			columns := []string{input}
+			if t.colsep != nil {
+				columns = t.colsep.Split(input, -1)
+			}
+			if n > len(columns) {
+				return ""
+			}
+			return columns[n-1]
+		}
+	})
+}
+
+func withoutExtension(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTokenExpanderExpand(t *testing.T) {
+	job := &xargsJob{seq: 3, slot: 2, input: []string{"dir/sub/file.tar.gz"}}
+	cases := []struct {
+		name        string
+		template    string
+		replacement string
+		colsep      *regexp.Regexp
+		input       []string
+		want        string
+	}{
+		{"input", "{}", "", nil, nil, "dir/sub/file.tar.gz"},
+		{"without extension", "{.}", "", nil, nil, "dir/sub/file.tar"},
+		{"base name", "{/}", "", nil, nil, "file.tar.gz"},
+		{"directory", "{//}", "", nil, nil, "dir/sub"},
+		{"base name without extension", "{/.}", "", nil, nil, "file.tar"},
+		{"job number and slot", "job {#} slot {%}", "", nil, nil, "job 3 slot 2"},
+		{"replacement string", "X/{/}", "X", nil, nil, "dir/sub/file.tar.gz/file.tar.gz"},
+		{"column without separator is whole input", "{1}", "", nil, nil, "dir/sub/file.tar.gz"},
+		{"columns", "{2}-{1}-{3}", "", regexp.MustCompile(`\t`), []string{"a\tb"}, "b-a-"},
+		{"input containing tokens is not expanded", "{}", "", nil, []string{"{#}"}, "{#}"},
+		{"unknown tokens are kept", "{0} {x}", "", nil, nil, "{0} {x}"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			j := *job
+			if c.input != nil {
+				j.input = c.input
+			}
+			got := newTokenExpander(c.replacement, false, c.colsep).expand(c.template, &j)
+			if got != c.want {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestTokenExpanderExpandArg(t *testing.T) {
+	job := &xargsJob{seq: 3, input: []string{"hello"}}
+	cases := []struct {
+		name        string
+		replacement string
+		allTokens   bool
+		arg         string
+		want        string
+	}{
+		{"replacement only", "X", false, "X {} {#}", "hello {} {#}"},
+		{"braces replacement", "{}", false, "{} {#} {.}", "hello {#} {.}"},
+		{"all tokens and replacement", "X", true, "X {} {#}", "hello hello 3"},
+		{"braces of regular expression are not a column", "{}", false, "a{2} {}", "a{2} hello"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := newTokenExpander(c.replacement, c.allTokens, nil).expandArg(c.arg, job)
+			if got != c.want {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestTokenExpanderReplacesArgs(t *testing.T) {
+	if newTokenExpander("", false, nil).replacesArgs() {
+		t.Errorf("got %v want %v", true, false)
+	}
+	if !newTokenExpander("", true, nil).replacesArgs() {
+		t.Errorf("got %v want %v", false, true)
+	}
+	if !newTokenExpander("R", false, nil).replacesArgs() {
+		t.Errorf("got %v want %v", false, true)
+	}
+}
+
+func TestRunJobExpandsSlot(t *testing.T) {
+	tokens := newTokenExpander("", true, nil)
+	scanner := bufio.NewScanner(strings.NewReader("a\nb\n"))
+	argch := make(chan *xargsJob, 2)
+	passBySingle(scanner, []string{"echo", "{}", "{%}"}, argch, nil, tokens, 0)
+	close(argch)
+
+	outch := make(chan jobOutput, 4)
+	runner := &jobRunner{outch: outch, opts: runOptions{dryRun: true, tokens: tokens}}
+	// the second job gets the slot of the first one, since it is started after the first one is done
+	newScheduler(1).run(argch, nil, runner.runJob)
+	close(outch)
+
+	var got strings.Builder
+	for out := range outch {
+		got.WriteString(out.data)
+	}
+	if want := "echo a 1\necho b 1\n"; got.String() != want {
+		t.Errorf("got %q want %q", got.String(), want)
+	}
+}
@@ -16,10 +16,9 @@ require (
 	github.com/dustin/go-humanize v1.0.1
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/cobra v1.8.0
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.8.4
 	github.com/tklauser/go-sysconf v0.3.13
 	golang.org/x/net v0.19.0
-	golang.org/x/sync v0.5.0
 	golang.org/x/text v0.14.0 // indirect
 )